@@ -0,0 +1,537 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/LegendLoreLori/radgregator/internal/auth"
+	"github.com/LegendLoreLori/radgregator/internal/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type apiUser struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Name      string    `json:"name"`
+}
+
+type apiUserWithKey struct {
+	apiUser
+	ApiKey string `json:"api_key"`
+}
+
+type apiFeed struct {
+	ID            uuid.UUID  `json:"id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	Name          string     `json:"name"`
+	Url           string     `json:"url"`
+	UserID        uuid.UUID  `json:"user_id"`
+	LastFetchedAt *time.Time `json:"last_fetched_at"`
+}
+
+type apiFeedUser struct {
+	Name     string `json:"name"`
+	Url      string `json:"url"`
+	UserName string `json:"user_name"`
+}
+
+type apiFeedFollow struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UserID    uuid.UUID `json:"user_id"`
+	FeedID    uuid.UUID `json:"feed_id"`
+	UserName  string    `json:"user_name,omitempty"`
+	FeedName  string    `json:"feed_name,omitempty"`
+}
+
+type apiFollowedFeed struct {
+	UserName string    `json:"user_name"`
+	FeedName string    `json:"feed_name"`
+	FeedID   uuid.UUID `json:"feed_id"`
+	FeedUrl  string    `json:"feed_url"`
+	Tags     []string  `json:"tags"`
+}
+
+type apiPost struct {
+	ID          uuid.UUID  `json:"id"`
+	Title       string     `json:"title"`
+	Url         string     `json:"url"`
+	Description string     `json:"description"`
+	PublishedAt *time.Time `json:"published_at"`
+	Author      string     `json:"author"`
+	Categories  []string   `json:"categories"`
+	FeedName    string     `json:"feed_name"`
+	ReadAt      *time.Time `json:"read_at"`
+	Highlighted bool       `json:"highlighted"`
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func apiUserFromDatabase(user database.User) apiUser {
+	return apiUser{
+		ID:        user.ID,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+		Name:      user.Name,
+	}
+}
+
+func apiFeedFromDatabase(feed database.Feed) apiFeed {
+	return apiFeed{
+		ID:            feed.ID,
+		CreatedAt:     feed.CreatedAt,
+		UpdatedAt:     feed.UpdatedAt,
+		Name:          feed.Name,
+		Url:           feed.Url,
+		UserID:        feed.UserID,
+		LastFetchedAt: nullTimePtr(feed.LastFetchedAt),
+	}
+}
+
+func apiFeedUserFromDatabase(feed database.GetFeedsUsersRow) apiFeedUser {
+	return apiFeedUser{
+		Name:     feed.Name,
+		Url:      feed.Url,
+		UserName: feed.UserName.String,
+	}
+}
+
+func apiFeedFollowFromDatabase(follow database.CreateFeedFollowRow) apiFeedFollow {
+	return apiFeedFollow{
+		ID:        follow.ID,
+		CreatedAt: follow.CreatedAt,
+		UpdatedAt: follow.UpdatedAt,
+		UserID:    follow.UserID,
+		FeedID:    follow.FeedID,
+		UserName:  follow.UserName,
+		FeedName:  follow.FeedName,
+	}
+}
+
+func apiFollowedFeedFromDatabase(follow database.GetFeedFollowsForUserRow) apiFollowedFeed {
+	return apiFollowedFeed{
+		UserName: follow.UserName,
+		FeedName: follow.FeedName,
+		FeedID:   follow.FeedID,
+		FeedUrl:  follow.FeedUrl,
+		Tags:     follow.Tags,
+	}
+}
+
+func apiPostFromDatabase(post database.GetPostsForUserByPublishedRow) apiPost {
+	return apiPost{
+		ID:          post.ID,
+		Title:       post.Title.String,
+		Url:         post.Url,
+		Description: post.Description.String,
+		PublishedAt: nullTimePtr(post.PublishedAt),
+		Author:      post.Author.String,
+		Categories:  post.Categories,
+		FeedName:    post.FeedName,
+		ReadAt:      nullTimePtr(post.ReadAt),
+		Highlighted: post.Highlighted,
+	}
+}
+
+func respondWithJSON(w http.ResponseWriter, code int, payload any) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("error marshalling response: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(data)
+}
+
+func respondWithError(w http.ResponseWriter, code int, msg string) {
+	respondWithJSON(w, code, map[string]string{"error": msg})
+}
+
+// respondWithDBError maps the database errors a handler can reasonably expect
+// onto status codes, anything else is logged and reported as a 500
+func respondWithDBError(w http.ResponseWriter, err error) {
+	var sqlErr *pq.Error
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		respondWithError(w, http.StatusNotFound, "not found")
+	case errors.As(err, &sqlErr) && sqlErr.Code == "23505": // duplicate key entry
+		respondWithError(w, http.StatusConflict, "already exists")
+	default:
+		log.Printf("api database error: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "internal server error")
+	}
+}
+
+func decodeBody(r *http.Request, v any) error {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+// apiMiddlewareAuth is the http counterpart to middlewareLoggedIn, requests
+// identify the user with an "Authorization: ApiKey <key>" header
+func (s *state) apiMiddlewareAuth(handler func(w http.ResponseWriter, r *http.Request, user database.User)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "ApiKey ")
+		if !ok || key == "" {
+			respondWithError(w, http.StatusUnauthorized, "missing api key")
+			return
+		}
+		user, err := s.db.GetUserByAPIKey(r.Context(), sql.NullString{
+			String: auth.HashAPIKey(key),
+			Valid:  true,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusUnauthorized, "invalid api key")
+			return
+		} else if err != nil {
+			respondWithDBError(w, err)
+			return
+		}
+		handler(w, r, user)
+	}
+}
+
+func (s *state) handlerAPICreateUser(w http.ResponseWriter, r *http.Request) {
+	var params struct {
+		Name string `json:"name"`
+	}
+	if err := decodeBody(r, &params); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if params.Name == "" {
+		respondWithError(w, http.StatusBadRequest, "missing field name")
+		return
+	}
+
+	key, hash, err := auth.MakeAPIKey()
+	if err != nil {
+		log.Print(err)
+		respondWithError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	user, err := s.db.CreateUser(r.Context(), database.CreateUserParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		Name:      params.Name,
+		ApiKeyHash: sql.NullString{
+			String: hash,
+			Valid:  true,
+		},
+	})
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	log.Printf("user created: %+v\n", user)
+	respondWithJSON(w, http.StatusCreated, apiUserWithKey{apiUserFromDatabase(user), key})
+}
+
+func (s *state) handlerAPIGetUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := s.db.GetUsers(r.Context())
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	res := make([]apiUser, 0, len(users))
+	for _, user := range users {
+		res = append(res, apiUserFromDatabase(user))
+	}
+	respondWithJSON(w, http.StatusOK, res)
+}
+
+func (s *state) handlerAPICreateFeed(w http.ResponseWriter, r *http.Request, user database.User) {
+	var params struct {
+		Name string `json:"name"`
+		Url  string `json:"url"`
+	}
+	if err := decodeBody(r, &params); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if params.Name == "" || params.Url == "" {
+		respondWithError(w, http.StatusBadRequest, "missing field name or url")
+		return
+	}
+
+	feed, err := s.db.CreateFeed(r.Context(), database.CreateFeedParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		Name:      params.Name,
+		Url:       params.Url,
+		UserID:    user.ID,
+	})
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	feedFollow, err := s.db.CreateFeedFollow(r.Context(), database.CreateFeedFollowParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		UserID:    user.ID,
+		FeedID:    feed.ID,
+	})
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	log.Printf("feed created: %+v\n", feed)
+	respondWithJSON(w, http.StatusCreated, struct {
+		Feed       apiFeed       `json:"feed"`
+		FeedFollow apiFeedFollow `json:"feed_follow"`
+	}{apiFeedFromDatabase(feed), apiFeedFollowFromDatabase(feedFollow)})
+}
+
+func (s *state) handlerAPIGetFeeds(w http.ResponseWriter, r *http.Request) {
+	feeds, err := s.db.GetFeedsUsers(r.Context())
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	res := make([]apiFeedUser, 0, len(feeds))
+	for _, feed := range feeds {
+		res = append(res, apiFeedUserFromDatabase(feed))
+	}
+	respondWithJSON(w, http.StatusOK, res)
+}
+
+func (s *state) handlerAPICreateFeedFollow(w http.ResponseWriter, r *http.Request, user database.User) {
+	var params struct {
+		Url string `json:"url"`
+	}
+	if err := decodeBody(r, &params); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if params.Url == "" {
+		respondWithError(w, http.StatusBadRequest, "missing field url")
+		return
+	}
+
+	feed, err := s.db.GetFeed(r.Context(), params.Url)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	feedFollow, err := s.db.CreateFeedFollow(r.Context(), database.CreateFeedFollowParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		UserID:    user.ID,
+		FeedID:    feed.ID,
+	})
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	filterFollowedFeed(r.Context(), s, user.ID, feed.ID)
+	log.Printf("feed_follow created: %+v\n", feedFollow)
+	respondWithJSON(w, http.StatusCreated, apiFeedFollowFromDatabase(feedFollow))
+}
+
+func (s *state) handlerAPIGetFeedFollows(w http.ResponseWriter, r *http.Request, user database.User) {
+	tag := r.URL.Query().Get("tag")
+	following, err := s.db.GetFeedFollowsForUser(r.Context(), database.GetFeedFollowsForUserParams{
+		Name: user.Name,
+		Tag: sql.NullString{
+			String: tag,
+			Valid:  tag != "",
+		},
+	})
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	res := make([]apiFollowedFeed, 0, len(following))
+	for _, follow := range following {
+		res = append(res, apiFollowedFeedFromDatabase(follow))
+	}
+	respondWithJSON(w, http.StatusOK, res)
+}
+
+func (s *state) handlerAPIDeleteFeedFollow(w http.ResponseWriter, r *http.Request, user database.User) {
+	url := r.URL.Query().Get("url")
+	if url == "" {
+		respondWithError(w, http.StatusBadRequest, "missing query parameter url")
+		return
+	}
+
+	deleted, err := s.db.DeleteFeedFollow(r.Context(), database.DeleteFeedFollowParams{
+		UserID: user.ID,
+		Url:    url,
+	})
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	log.Printf("feed_follow deleted: %+v", deleted)
+	respondWithJSON(w, http.StatusOK, apiFeedFollow{
+		ID:        deleted.ID,
+		CreatedAt: deleted.CreatedAt,
+		UpdatedAt: deleted.UpdatedAt,
+		UserID:    deleted.UserID,
+		FeedID:    deleted.FeedID,
+	})
+}
+
+func (s *state) handlerAPIGetPosts(w http.ResponseWriter, r *http.Request, user database.User) {
+	limit := 10
+	if param := r.URL.Query().Get("limit"); param != "" {
+		var err error
+		limit, err = strconv.Atoi(param)
+		if err != nil || limit < 1 || limit > 100 {
+			respondWithError(w, http.StatusBadRequest, "limit must be a number between 1 and 100")
+			return
+		}
+	}
+
+	includeRead := r.URL.Query().Get("include_read") == "true"
+	includeHidden := r.URL.Query().Get("include_hidden") == "true"
+	tag := r.URL.Query().Get("tag")
+	author := r.URL.Query().Get("author")
+	category := r.URL.Query().Get("category")
+
+	params := postQuery{}
+	params.GetPostsForUserByPublishedParams = database.GetPostsForUserByPublishedParams{
+		UserID:        user.ID,
+		IncludeRead:   includeRead,
+		IncludeHidden: includeHidden,
+		Tag: sql.NullString{
+			String: tag,
+			Valid:  tag != "",
+		},
+		Author: sql.NullString{
+			String: author,
+			Valid:  author != "",
+		},
+		Category: sql.NullString{
+			String: category,
+			Valid:  category != "",
+		},
+		Limit: int32(limit),
+	}
+
+	query := r.URL.Query()
+	sortBy, order := query.Get("sort"), query.Get("order")
+	if sortBy == "" {
+		sortBy = "published"
+	}
+	if order == "" {
+		order = "desc"
+	}
+	var err error
+	if params.SortBy, params.Descending, err = parsePostSort(sortBy, order); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if params.Since, err = parseDateFlag("since", query.Get("since")); err != nil {
+		respondWithError(w, http.StatusBadRequest, "since must be a date like YYYY-MM-DD")
+		return
+	}
+	if params.Until, err = parseDateFlag("until", query.Get("until")); err != nil {
+		respondWithError(w, http.StatusBadRequest, "until must be a date like YYYY-MM-DD")
+		return
+	}
+	if feedUrl := query.Get("feed"); feedUrl != "" {
+		feed, err := s.db.GetFeed(r.Context(), feedUrl)
+		if err != nil {
+			respondWithDBError(w, err)
+			return
+		}
+		params.FeedID = uuid.NullUUID{
+			UUID:  feed.ID,
+			Valid: true,
+		}
+	}
+	if err := applyCursor(&params, query.Get("cursor")); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	posts, err := getPostsForUser(r.Context(), s.db, params)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	if next := nextCursor(params, posts); next != "" {
+		query.Set("cursor", next)
+		w.Header().Set("Link", fmt.Sprintf("<%s?%s>; rel=\"next\"", r.URL.Path, query.Encode()))
+	}
+	res := make([]apiPost, 0, len(posts))
+	for _, post := range posts {
+		res = append(res, apiPostFromDatabase(post))
+	}
+	respondWithJSON(w, http.StatusOK, res)
+}
+
+func handlerServe(s *state, cmd command) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := fs.String("addr", "localhost:8080", "address to listen on")
+	if _, err := cmd.parseFlags(fs); err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/users", s.handlerAPICreateUser)
+	mux.HandleFunc("GET /v1/users", s.handlerAPIGetUsers)
+	mux.HandleFunc("POST /v1/feeds", s.apiMiddlewareAuth(s.handlerAPICreateFeed))
+	mux.HandleFunc("GET /v1/feeds", s.handlerAPIGetFeeds)
+	mux.HandleFunc("POST /v1/feed_follows", s.apiMiddlewareAuth(s.handlerAPICreateFeedFollow))
+	mux.HandleFunc("GET /v1/feed_follows", s.apiMiddlewareAuth(s.handlerAPIGetFeedFollows))
+	mux.HandleFunc("DELETE /v1/feed_follows", s.apiMiddlewareAuth(s.handlerAPIDeleteFeedFollow))
+	mux.HandleFunc("GET /v1/posts", s.apiMiddlewareAuth(s.handlerAPIGetPosts))
+
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.ListenAndServe()
+	}()
+	fmt.Printf("serving api on %s\n", *addr)
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	println("server stopped")
+	return nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import "strings"
+
+type AtomFeed struct {
+	Title    string       `xml:"title"`
+	Subtitle string       `xml:"subtitle"`
+	Updated  string       `xml:"updated"`
+	Link     []AtomLink   `xml:"link"`
+	Author   []AtomPerson `xml:"author"`
+	Entry    []AtomEntry  `xml:"entry"`
+
+	UpdatePeriod    string `xml:"http://purl.org/rss/1.0/modules/syndication/ updatePeriod"`
+	UpdateFrequency string `xml:"http://purl.org/rss/1.0/modules/syndication/ updateFrequency"`
+}
+
+type AtomEntry struct {
+	ID        string         `xml:"id"`
+	Title     string         `xml:"title"`
+	Link      []AtomLink     `xml:"link"`
+	Summary   AtomText       `xml:"summary"`
+	Content   AtomText       `xml:"content"`
+	Published string         `xml:"published"`
+	Updated   string         `xml:"updated"`
+	Author    []AtomPerson   `xml:"author"`
+	Category  []AtomCategory `xml:"category"`
+}
+
+// AtomText is an atom text construct, xhtml content is made of child elements
+// rather than character data so it has to be pulled out as raw xml
+type AtomText struct {
+	Type  string `xml:"type,attr"`
+	Text  string `xml:",chardata"`
+	Inner string `xml:",innerxml"`
+}
+
+func (t AtomText) String() string {
+	if t.Type == "xhtml" {
+		return strings.TrimSpace(t.Inner)
+	}
+	return strings.TrimSpace(t.Text)
+}
+
+type AtomPerson struct {
+	Name string `xml:"name"`
+}
+
+type AtomCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr"`
+}
+
+// authorNames joins the names of everyone credited, entries without an author
+// inherit the feed's
+func authorNames(people []AtomPerson) string {
+	var names []string
+	for _, person := range people {
+		if name := strings.TrimSpace(person.Name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+type AtomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr"`
+	Type   string `xml:"type,attr"`
+	Length string `xml:"length,attr"`
+}
+
+// alternateLink returns the href of the rel="alternate" link, a link with no
+// rel attribute is an alternate link as far as the spec is concerned
+func alternateLink(links []AtomLink) string {
+	for _, link := range links {
+		if link.Rel == "" || link.Rel == "alternate" {
+			return link.Href
+		}
+	}
+	if len(links) > 0 {
+		return links[0].Href
+	}
+	return ""
+}
+
+// toRSS normalises an atom feed into the same shape as an rss feed so
+// scrapeFeeds doesn't need to care where the items came from
+func (a *AtomFeed) toRSS() *RSSFeed {
+	var feed RSSFeed
+	feed.Channel.Title = a.Title
+	feed.Channel.Link = alternateLink(a.Link)
+	feed.Channel.Description = a.Subtitle
+	feed.Channel.LastBuildDate = a.Updated
+	feed.Channel.UpdatePeriod = a.UpdatePeriod
+	feed.Channel.UpdateFrequency = a.UpdateFrequency
+
+	for _, entry := range a.Entry {
+		item := RSSItem{
+			Title:       entry.Title,
+			Link:        alternateLink(entry.Link),
+			Description: entry.Summary.String(),
+			PubDate:     entry.Published,
+			Content:     entry.Content.String(),
+			Creator:     authorNames(entry.Author),
+			// atom ids are usually tag: or urn: uris rather than something
+			// a browser could open
+			GUID: RSSGUID{
+				Value:       entry.ID,
+				IsPermaLink: "false",
+			},
+		}
+		if item.Creator == "" {
+			item.Creator = authorNames(a.Author)
+		}
+		for _, category := range entry.Category {
+			item.Category = append(item.Category, category.Term)
+		}
+		for _, link := range entry.Link {
+			if link.Rel == "enclosure" {
+				item.Enclosure = append(item.Enclosure, RSSEnclosure{
+					URL:    link.Href,
+					Type:   link.Type,
+					Length: link.Length,
+				})
+			}
+		}
+		if item.Description == "" {
+			item.Description = entry.Content.String()
+		}
+		if item.PubDate == "" {
+			item.PubDate = entry.Updated
+		}
+		feed.Channel.Item = append(feed.Channel.Item, item)
+	}
+
+	return &feed
+}
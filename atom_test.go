@@ -0,0 +1,125 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestAlternateLink(t *testing.T) {
+	tests := []struct {
+		name  string
+		links []AtomLink
+		want  string
+	}{
+		{"no links", nil, ""},
+		{"alternate", []AtomLink{
+			{Href: "https://example.com/feed", Rel: "self"},
+			{Href: "https://example.com/post", Rel: "alternate"},
+		}, "https://example.com/post"},
+		{"no rel is alternate", []AtomLink{
+			{Href: "https://example.com/feed", Rel: "self"},
+			{Href: "https://example.com/post"},
+		}, "https://example.com/post"},
+		{"first alternate wins", []AtomLink{
+			{Href: "https://example.com/post", Rel: "alternate"},
+			{Href: "https://example.com/other", Rel: "alternate"},
+		}, "https://example.com/post"},
+		{"falls back to the first link", []AtomLink{
+			{Href: "https://example.com/feed", Rel: "self"},
+			{Href: "https://example.com/episode.mp3", Rel: "enclosure"},
+		}, "https://example.com/feed"},
+	}
+
+	for _, tt := range tests {
+		if got := alternateLink(tt.links); got != tt.want {
+			t.Errorf("%s: alternateLink = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+const atomFeed = `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+	<title>Example</title>
+	<subtitle>an example feed</subtitle>
+	<updated>2024-09-03T16:05:00Z</updated>
+	<link rel="self" href="https://example.com/atom.xml"/>
+	<link href="https://example.com/"/>
+	<author><name>Feed Author</name></author>
+	<entry>
+		<id>tag:example.com,2024:1</id>
+		<title>First</title>
+		<link rel="alternate" href="https://example.com/first"/>
+		<link rel="enclosure" href="https://example.com/first.mp3" type="audio/mpeg" length="1234"/>
+		<published>2024-09-03T16:05:00Z</published>
+		<updated>2024-09-04T08:00:00Z</updated>
+		<summary>the summary</summary>
+		<content type="html">&lt;p&gt;the content&lt;/p&gt;</content>
+		<author><name>Alice</name></author>
+		<author><name>Bob</name></author>
+		<category term="go" label="Go"/>
+		<category term="feeds"/>
+	</entry>
+	<entry>
+		<id>tag:example.com,2024:2</id>
+		<title>Second</title>
+		<link href="https://example.com/second"/>
+		<updated>2024-09-04T08:00:00Z</updated>
+		<content type="xhtml"><div xmlns="http://www.w3.org/1999/xhtml"><p>only content</p></div></content>
+	</entry>
+</feed>`
+
+func TestAtomToRSS(t *testing.T) {
+	feed, err := parseFeed([]byte(atomFeed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feed.Channel.Title != "Example" || feed.Channel.Link != "https://example.com/" ||
+		feed.Channel.Description != "an example feed" || feed.Channel.LastBuildDate != "2024-09-03T16:05:00Z" {
+		t.Errorf("channel = %q %q %q %q", feed.Channel.Title, feed.Channel.Link, feed.Channel.Description, feed.Channel.LastBuildDate)
+	}
+	if len(feed.Channel.Item) != 2 {
+		t.Fatalf("got %d items, want 2", len(feed.Channel.Item))
+	}
+
+	first := feed.Channel.Item[0]
+	tests := []struct {
+		field string
+		got   string
+		want  string
+	}{
+		{"title", first.Title, "First"},
+		{"link", first.Link, "https://example.com/first"},
+		{"description", first.Description, "the summary"},
+		{"content", first.Content, "<p>the content</p>"},
+		{"pubDate", first.PubDate, "2024-09-03T16:05:00Z"},
+		{"author", first.author(), "Alice, Bob"},
+		{"guid", first.GUID.Value, "tag:example.com,2024:1"},
+		{"isPermaLink", first.GUID.IsPermaLink, "false"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("first entry %s = %q, want %q", tt.field, tt.got, tt.want)
+		}
+	}
+	if want := []string{"go", "feeds"}; !slices.Equal(first.Category, want) {
+		t.Errorf("first entry categories = %q, want %q", first.Category, want)
+	}
+	if want := []RSSEnclosure{{URL: "https://example.com/first.mp3", Type: "audio/mpeg", Length: "1234"}}; !slices.Equal(first.Enclosure, want) {
+		t.Errorf("first entry enclosures = %+v, want %+v", first.Enclosure, want)
+	}
+
+	// no summary, published date or author of its own
+	second := feed.Channel.Item[1]
+	if second.Link != "https://example.com/second" {
+		t.Errorf("second entry link = %q", second.Link)
+	}
+	if want := `<div xmlns="http://www.w3.org/1999/xhtml"><p>only content</p></div>`; second.Description != want {
+		t.Errorf("second entry description = %q, want %q", second.Description, want)
+	}
+	if second.PubDate != "2024-09-04T08:00:00Z" {
+		t.Errorf("second entry pubDate = %q, want the updated date", second.PubDate)
+	}
+	if second.author() != "Feed Author" {
+		t.Errorf("second entry author = %q, want the feed's author", second.author())
+	}
+}
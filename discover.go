@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	linkTagRegex   = regexp.MustCompile(`(?is)<link\b[^>]*>`)
+	attributeRegex = regexp.MustCompile(`(?s)([a-zA-Z-]+)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+)
+
+var feedMimeTypes = []string{
+	"application/rss+xml",
+	"application/atom+xml",
+	"application/feed+json",
+	"application/json",
+}
+
+// commonFeedPaths are tried against the site root when a page doesn't
+// advertise any feeds itself
+var commonFeedPaths = []string{"/feed", "/rss.xml", "/atom.xml", "/feed.xml", "/index.xml", "/feed.json"}
+
+type feedCandidate struct {
+	url   string
+	title string
+	feed  *RSSFeed
+}
+
+// discoverFeed resolves pageUrl to a feed. pageUrl is returned as is if it's
+// already a feed, otherwise the page is searched for alternate links and the
+// common feed paths are probed. When several feeds turn up the user is asked
+// to pick one, the chosen feed is always fetched to make sure it parses
+func discoverFeed(ctx context.Context, pageUrl string) (string, *RSSFeed, error) {
+	if feed, err := fetchFeed(ctx, pageUrl, nil); err == nil {
+		return pageUrl, feed, nil
+	}
+
+	base, err := url.Parse(pageUrl)
+	if err != nil {
+		return "", nil, err
+	}
+	page, err := fetchPage(ctx, pageUrl)
+	if err != nil {
+		return "", nil, err
+	}
+
+	candidates := alternateLinks(base, page)
+	if len(candidates) == 0 {
+		for _, path := range commonFeedPaths {
+			probe := base.ResolveReference(&url.URL{Path: path}).String()
+			feed, err := fetchFeed(ctx, probe, nil)
+			if err != nil {
+				continue
+			}
+			candidates = append(candidates, feedCandidate{url: probe, title: feed.Channel.Title, feed: feed})
+		}
+	}
+	if len(candidates) == 0 {
+		return "", nil, fmt.Errorf("no feeds found at %q", pageUrl)
+	}
+
+	chosen := candidates[0]
+	if len(candidates) > 1 {
+		if chosen, err = chooseCandidate(candidates); err != nil {
+			return "", nil, err
+		}
+	}
+	if chosen.feed == nil {
+		if chosen.feed, err = fetchFeed(ctx, chosen.url, nil); err != nil {
+			return "", nil, fmt.Errorf("unable to fetch feed %q: %w", chosen.url, err)
+		}
+	}
+
+	return chosen.url, chosen.feed, nil
+}
+
+func fetchPage(ctx context.Context, pageUrl string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", pageUrl, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", "radgregator")
+	res, err := feedClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return "", &statusError{StatusCode: res.StatusCode}
+	}
+	data, err := io.ReadAll(io.LimitReader(res.Body, maxFeedSize))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// alternateLinks finds <link rel="alternate"> tags with a feed mime type,
+// html isn't xml so the tags are picked out with a regex rather than a parser
+func alternateLinks(base *url.URL, page string) []feedCandidate {
+	var candidates []feedCandidate
+	seen := make(map[string]bool)
+	for _, tag := range linkTagRegex.FindAllString(page, -1) {
+		attrs := make(map[string]string)
+		for _, match := range attributeRegex.FindAllStringSubmatch(tag, -1) {
+			attrs[strings.ToLower(match[1])] = match[2] + match[3] + match[4]
+		}
+
+		rels := strings.Fields(strings.ToLower(attrs["rel"]))
+		if !slices.Contains(rels, "alternate") {
+			continue
+		}
+		mimeType := strings.ToLower(strings.TrimSpace(attrs["type"]))
+		if !slices.Contains(feedMimeTypes, mimeType) || attrs["href"] == "" {
+			continue
+		}
+		href, err := base.Parse(attrs["href"])
+		if err != nil || seen[href.String()] {
+			continue
+		}
+		seen[href.String()] = true
+		candidates = append(candidates, feedCandidate{url: href.String(), title: attrs["title"]})
+	}
+	return candidates
+}
+
+func chooseCandidate(candidates []feedCandidate) (feedCandidate, error) {
+	println("found multiple feeds:")
+	for i, candidate := range candidates {
+		if candidate.title != "" {
+			fmt.Printf(" %d) %s - %s\n", i+1, candidate.title, candidate.url)
+			continue
+		}
+		fmt.Printf(" %d) %s\n", i+1, candidate.url)
+	}
+	fmt.Printf("pick a feed [1-%d]: ", len(candidates))
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+		return feedCandidate{}, errors.New("no feed picked, pass one of the urls above directly")
+	}
+	choice, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil || choice < 1 || choice > len(candidates) {
+		return feedCandidate{}, fmt.Errorf("invalid choice %q", strings.TrimSpace(line))
+	}
+	return candidates[choice-1], nil
+}
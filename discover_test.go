@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestAlternateLinks(t *testing.T) {
+	base, err := url.Parse("https://example.com/blog/post")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		page string
+		want []feedCandidate
+	}{
+		{"no links", `<html><head><title>nothing</title></head></html>`, nil},
+		{"rss", `<link rel="alternate" type="application/rss+xml" title="Posts" href="https://example.com/feed.xml">`,
+			[]feedCandidate{{url: "https://example.com/feed.xml", title: "Posts"}}},
+		{"relative hrefs", `<link rel="alternate" type="application/atom+xml" href="/atom.xml">
+			<link rel="alternate" type="application/feed+json" href="feed.json">`,
+			[]feedCandidate{{url: "https://example.com/atom.xml"}, {url: "https://example.com/blog/feed.json"}}},
+		{"attribute order, case and quoting", `<LINK HREF='/rss' TYPE="Application/RSS+XML" REL=alternate />`,
+			[]feedCandidate{{url: "https://example.com/rss"}}},
+		{"rel with several values", `<link rel="feed alternate" type="application/rss+xml" href="/rss">`,
+			[]feedCandidate{{url: "https://example.com/rss"}}},
+		{"tag over several lines", "<link\n\trel=\"alternate\"\n\ttype=\"application/rss+xml\"\n\thref=\"/rss\"\n>",
+			[]feedCandidate{{url: "https://example.com/rss"}}},
+		{"duplicates", `<link rel="alternate" type="application/rss+xml" href="/rss">
+			<link rel="alternate" type="application/rss+xml" href="https://example.com/rss">`,
+			[]feedCandidate{{url: "https://example.com/rss"}}},
+		{"not feeds", `<link rel="stylesheet" type="text/css" href="/style.css">
+			<link rel="alternate" type="text/html" hreflang="fr" href="/fr/">
+			<link rel="alternate" type="application/rss+xml">
+			<link rel="canonical" href="/blog/post">`, nil},
+	}
+
+	for _, tt := range tests {
+		got := alternateLinks(base, tt.page)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: alternateLinks = %+v, want %+v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i].url != tt.want[i].url || got[i].title != tt.want[i].title {
+				t.Errorf("%s: alternateLinks = %+v, want %+v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LegendLoreLori/radgregator/internal/database"
+	"github.com/google/uuid"
+)
+
+var (
+	filterActions = []string{"hide", "read", "highlight"}
+	filterFields  = []string{"any", "title", "description", "author", "category"}
+)
+
+// filterBatchSize is how many stored posts are loaded at a time when rules
+// are run over posts that were fetched before the rule or the follow existed
+const filterBatchSize = 500
+
+// filterRegexCache holds compiled patterns between fetches, the same rules
+// get evaluated for every post of every feed their owners follow
+var filterRegexCache sync.Map
+
+// filterRule is a rule ready to be evaluated, keyword rules are a case
+// insensitive substring match and regex rules use go's regexp syntax
+type filterRule struct {
+	database.FilterRule
+	regex   *regexp.Regexp
+	keyword string
+}
+
+func compileFilterRule(rule database.FilterRule) (filterRule, error) {
+	compiled := filterRule{FilterRule: rule}
+	if rule.MatchType == "keyword" {
+		compiled.keyword = strings.ToLower(rule.Pattern)
+		return compiled, nil
+	}
+	if cached, ok := filterRegexCache.Load(rule.Pattern); ok {
+		compiled.regex = cached.(*regexp.Regexp)
+		return compiled, nil
+	}
+	regex, err := regexp.Compile(rule.Pattern)
+	if err != nil {
+		return compiled, err
+	}
+	filterRegexCache.Store(rule.Pattern, regex)
+	compiled.regex = regex
+	return compiled, nil
+}
+
+func (rule filterRule) matchValue(value string) bool {
+	if rule.regex != nil {
+		return rule.regex.MatchString(value)
+	}
+	return strings.Contains(strings.ToLower(value), rule.keyword)
+}
+
+// applies reports whether the rule's action should be taken for the item,
+// include rules act on the items that don't match
+func (rule filterRule) applies(item RSSItem) bool {
+	var values []string
+	switch rule.Field {
+	case "title":
+		values = []string{item.Title}
+	case "description":
+		values = []string{item.Description}
+	case "author":
+		values = []string{item.author()}
+	case "category":
+		values = item.Category
+	default:
+		values = append([]string{item.Title, item.Description, item.author()}, item.Category...)
+	}
+
+	matched := slices.ContainsFunc(values, rule.matchValue)
+	if rule.Mode == "include" {
+		return !matched
+	}
+	return matched
+}
+
+// loadFilterRules fetches and compiles the rules for a feed once per fetch,
+// rules that no longer compile are skipped rather than failing the feed
+func loadFilterRules(ctx context.Context, s *state, feedID uuid.UUID) []filterRule {
+	rules, err := s.db.GetFilterRulesForFeed(ctx, feedID)
+	if err != nil {
+		log.Printf("error loading filter rules: %v", err)
+		return nil
+	}
+	compiled := make([]filterRule, 0, len(rules))
+	for _, rule := range rules {
+		c, err := compileFilterRule(rule)
+		if err != nil {
+			log.Printf("skipping filter rule %s: %v", rule.ID, err)
+			continue
+		}
+		compiled = append(compiled, c)
+	}
+	return compiled
+}
+
+// applyFilterRules records which rules act on a post as it's saved or edited,
+// read rules mark it read for the rule's owner the first time they match.
+// edited posts also lose the matches of rules that no longer apply to them
+func applyFilterRules(ctx context.Context, s *state, rules []filterRule, postID uuid.UUID, item RSSItem, edited bool) {
+	for _, rule := range rules {
+		if !rule.applies(item) {
+			if edited {
+				err := s.db.DeleteFilterMatch(ctx, database.DeleteFilterMatchParams{
+					RuleID: rule.ID,
+					PostID: postID,
+				})
+				if err != nil {
+					log.Printf("error removing filter rule %s from %s: %v", rule.ID, postID, err)
+				}
+			}
+			continue
+		}
+		matched, err := s.db.CreateFilterMatch(ctx, database.CreateFilterMatchParams{
+			RuleID: rule.ID,
+			PostID: postID,
+		})
+		if err == nil && matched > 0 && rule.Action == "read" {
+			_, err = s.db.MarkPostRead(ctx, database.MarkPostReadParams{
+				UserID: rule.UserID,
+				PostID: postID,
+				ReadAt: time.Now(),
+			})
+		}
+		if err != nil {
+			log.Printf("error applying filter rule %s to %s: %v", rule.ID, postID, err)
+		}
+	}
+}
+
+// filterStoredPosts runs rules over the posts already stored for the feeds the
+// user follows, or just feedID's when it's set, since dedup means those posts
+// are never ingested again for applyFilterRules to see
+func filterStoredPosts(ctx context.Context, s *state, userID uuid.UUID, feedID uuid.NullUUID, rules []filterRule) error {
+	if len(rules) == 0 {
+		return nil
+	}
+	var after uuid.UUID
+	for {
+		posts, err := s.db.GetPostsToFilter(ctx, database.GetPostsToFilterParams{
+			UserID: userID,
+			FeedID: feedID,
+			After:  after,
+			Limit:  filterBatchSize,
+		})
+		if err != nil {
+			return err
+		}
+		for _, post := range posts {
+			item := RSSItem{
+				Title:       post.Title.String,
+				Description: post.Description.String,
+				Creator:     post.Author.String,
+				Category:    post.Categories,
+			}
+			applyFilterRules(ctx, s, rules, post.ID, item, false)
+		}
+		if len(posts) < filterBatchSize {
+			return nil
+		}
+		after = posts[len(posts)-1].ID
+	}
+}
+
+// filterFollowedFeed runs a user's rules over the posts a feed already had
+// when they followed it, failures are logged rather than undoing the follow
+func filterFollowedFeed(ctx context.Context, s *state, userID, feedID uuid.UUID) {
+	rules, err := s.db.GetFilterRulesForUserFeed(ctx, database.GetFilterRulesForUserFeedParams{
+		UserID: userID,
+		FeedID: uuid.NullUUID{
+			UUID:  feedID,
+			Valid: true,
+		},
+	})
+	if err != nil {
+		log.Printf("error loading filter rules: %v", err)
+		return
+	}
+	compiled := make([]filterRule, 0, len(rules))
+	for _, rule := range rules {
+		c, err := compileFilterRule(rule)
+		if err != nil {
+			log.Printf("skipping filter rule %s: %v", rule.ID, err)
+			continue
+		}
+		compiled = append(compiled, c)
+	}
+	err = filterStoredPosts(ctx, s, userID, uuid.NullUUID{UUID: feedID, Valid: true}, compiled)
+	if err != nil {
+		log.Printf("error filtering stored posts of %s: %v", feedID, err)
+	}
+}
+
+func handlerFilter(s *state, cmd command, user database.User) error {
+	if len(cmd.args) < 2 {
+		return errors.New("missing positional argument [add|list|rm]")
+	}
+	sub := command{name: "filter " + cmd.args[1], args: cmd.args[1:]}
+	switch cmd.args[1] {
+	case "add":
+		return handlerFilterAdd(s, sub, user)
+	case "list":
+		return handlerFilterList(s, sub, user)
+	case "rm":
+		return handlerFilterRemove(s, sub, user)
+	}
+	return fmt.Errorf("unknown filter command %q, expected add, list or rm", cmd.args[1])
+}
+
+func handlerFilterAdd(s *state, cmd command, user database.User) error {
+	fs := flag.NewFlagSet("filter add", flag.ContinueOnError)
+	include := fs.Bool("include", false, "act on posts that don't match instead of ones that do")
+	field := fs.String("field", "any", "field to match: any, title, description, author or category")
+	regex := fs.Bool("regex", false, "treat the pattern as a regular expression instead of a keyword")
+	feedUrl := fs.String("feed", "", "only apply the rule to the feed with this url")
+	args, err := cmd.parseFlags(fs)
+	if err != nil {
+		return err
+	}
+	if len(args) < 2 {
+		return errors.New("missing positional arguments [hide|read|highlight] [PATTERN]")
+	}
+	action, pattern := args[0], strings.Join(args[1:], " ")
+	if !slices.Contains(filterActions, action) {
+		return fmt.Errorf("unknown action %q, expected hide, read or highlight", action)
+	}
+	if !slices.Contains(filterFields, *field) {
+		return fmt.Errorf("unknown field %q, expected any, title, description, author or category", *field)
+	}
+
+	params := database.CreateFilterRuleParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UserID:    user.ID,
+		Mode:      "exclude",
+		Field:     *field,
+		MatchType: "keyword",
+		Pattern:   pattern,
+		Action:    action,
+	}
+	if *include {
+		params.Mode = "include"
+	}
+	if *regex {
+		params.MatchType = "regex"
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid pattern: %w", err)
+		}
+	}
+	if *feedUrl != "" {
+		feed, err := s.db.GetFeed(context.Background(), *feedUrl)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("no feed found for %q", *feedUrl)
+		} else if err != nil {
+			return err
+		}
+		params.FeedID = uuid.NullUUID{
+			UUID:  feed.ID,
+			Valid: true,
+		}
+	}
+
+	rule, err := s.db.CreateFilterRule(context.Background(), params)
+	if err != nil {
+		return err
+	}
+	compiled, err := compileFilterRule(rule)
+	if err != nil {
+		return err
+	}
+	if err := filterStoredPosts(context.Background(), s, user.ID, rule.FeedID, []filterRule{compiled}); err != nil {
+		return fmt.Errorf("added filter rule %s but couldn't apply it to stored posts: %w", rule.ID, err)
+	}
+	fmt.Printf("added filter rule %s\n", rule.ID)
+	log.Printf("filter_rule created: %+v\n", rule)
+	return nil
+}
+
+func handlerFilterList(s *state, _ command, user database.User) error {
+	rules, err := s.db.GetFilterRulesForUser(context.Background(), user.ID)
+	if err != nil {
+		return err
+	}
+	if len(rules) == 0 {
+		println("no filter rules")
+		return nil
+	}
+
+	for _, rule := range rules {
+		condition := "matching"
+		if rule.Mode == "include" {
+			condition = "not matching"
+		}
+		scope := "all feeds"
+		if rule.FeedUrl.Valid {
+			scope = rule.FeedUrl.String
+		}
+		fmt.Printf(" * %s\n   %s posts with %s %s %s %q in %s\n",
+			rule.ID, rule.Action, rule.Field, condition, rule.MatchType, rule.Pattern, scope)
+	}
+	return nil
+}
+
+func handlerFilterRemove(s *state, cmd command, user database.User) error {
+	if len(cmd.args) < 2 {
+		return errors.New("missing positional argument [RULE_ID]")
+	}
+	ruleID, err := uuid.Parse(cmd.args[1])
+	if err != nil {
+		return fmt.Errorf("invalid rule id %q: %w", cmd.args[1], err)
+	}
+	deleted, err := s.db.DeleteFilterRule(context.Background(), database.DeleteFilterRuleParams{
+		UserID: user.ID,
+		ID:     ruleID,
+	})
+	if err != nil {
+		return err
+	} else if deleted == 0 {
+		return fmt.Errorf("no filter rule %s", ruleID)
+	}
+
+	fmt.Printf("removed filter rule %s\n", ruleID)
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/LegendLoreLori/radgregator/internal/database"
+)
+
+func TestFilterRuleApplies(t *testing.T) {
+	item := RSSItem{
+		Title:       "Go 1.23 is released",
+		Description: "range over func iterators land",
+		Creator:     "The Go Team",
+		Author:      "noreply@example.com",
+		Category:    []string{"Release", "golang"},
+	}
+
+	tests := []struct {
+		name      string
+		mode      string
+		field     string
+		matchType string
+		pattern   string
+		want      bool
+	}{
+		{"keyword in title", "exclude", "title", "keyword", "go 1.23", true},
+		{"keyword is case insensitive", "exclude", "title", "keyword", "RELEASED", true},
+		{"keyword in another field", "exclude", "title", "keyword", "iterators", false},
+		{"keyword in description", "exclude", "description", "keyword", "iterators", true},
+		{"author prefers the creator", "exclude", "author", "keyword", "go team", true},
+		{"author ignores the email", "exclude", "author", "keyword", "noreply", false},
+		{"category", "exclude", "category", "keyword", "release", true},
+		{"category misses", "exclude", "category", "keyword", "rust", false},
+		{"any looks at everything", "exclude", "any", "keyword", "golang", true},
+		{"any misses", "exclude", "any", "keyword", "rust", false},
+		{"regex", "exclude", "title", "regex", `^Go \d+\.\d+`, true},
+		{"regex is case sensitive", "exclude", "title", "regex", `^go`, false},
+		{"regex with a flag", "exclude", "title", "regex", `(?i)^go`, true},
+		{"regex over categories", "exclude", "category", "regex", `^gol`, true},
+		{"include acts on misses", "include", "title", "keyword", "rust", true},
+		{"include leaves matches", "include", "title", "keyword", "go", false},
+		{"include with a regex", "include", "any", "regex", `iterator`, false},
+	}
+
+	for _, tt := range tests {
+		rule, err := compileFilterRule(database.FilterRule{
+			Mode:      tt.mode,
+			Field:     tt.field,
+			MatchType: tt.matchType,
+			Pattern:   tt.pattern,
+		})
+		if err != nil {
+			t.Errorf("%s: compileFilterRule returned error: %v", tt.name, err)
+			continue
+		}
+		if got := rule.applies(item); got != tt.want {
+			t.Errorf("%s: applies = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCompileFilterRuleInvalid(t *testing.T) {
+	_, err := compileFilterRule(database.FilterRule{
+		Mode:      "exclude",
+		Field:     "title",
+		MatchType: "regex",
+		Pattern:   `(unclosed`,
+	})
+	if err == nil {
+		t.Error("compiling an invalid regex succeeded")
+	}
+}
@@ -0,0 +1,28 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+const apiKeyBytes = 32
+
+// MakeAPIKey generates a new random api key and the hash that gets stored in
+// place of it, the key itself is never saved anywhere
+func MakeAPIKey() (key string, hash string, err error) {
+	data := make([]byte, apiKeyBytes)
+	if _, err := rand.Read(data); err != nil {
+		return "", "", fmt.Errorf("unable to generate api key: %w", err)
+	}
+	key = hex.EncodeToString(data)
+	return key, HashAPIKey(key), nil
+}
+
+// HashAPIKey hashes a key for storage or lookup, the keys are long and random
+// so a plain sha256 is enough, there's nothing to brute force
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -14,6 +14,8 @@ const (
 type Config struct {
 	DbUrl           string `json:"db_url"`
 	CurrentUserName string `json:"current_user_name"`
+	APIKey          string `json:"api_key,omitempty"`
+	DownloadDir     string `json:"download_dir,omitempty"`
 }
 
 func Read() (Config, error) {
@@ -44,14 +46,30 @@ func Read() (Config, error) {
 	return cfg, nil
 }
 
-func (c *Config) SetUser(name string) error {
+// SetUser logs in as name, the api key is what proves it's that user so it
+// has to be kept with the name. the file is only readable by its owner
+func (c *Config) SetUser(name, apiKey string) error {
 	c.CurrentUserName = name
+	c.APIKey = apiKey
 	if err := write(*c); err != nil {
 		return fmt.Errorf("error calling Config method write: %w", err)
 	}
 	return nil
 }
 
+// DownloadPath is where downloaded enclosures are saved, download_dir if it's
+// set and ~/radgregator otherwise
+func (c *Config) DownloadPath() (string, error) {
+	if c.DownloadDir != "" {
+		return c.DownloadDir, nil
+	}
+	path, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return path + "/radgregator", nil
+}
+
 func configFilePath() (string, error) {
 	path, err := os.UserHomeDir()
 	if err != nil {
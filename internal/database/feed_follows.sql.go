@@ -7,9 +7,11 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 const createFeedFollow = `-- name: CreateFeedFollow :one
@@ -74,14 +76,13 @@ func (q *Queries) CreateFeedFollow(ctx context.Context, arg CreateFeedFollowPara
 }
 
 const deleteFeedFollow = `-- name: DeleteFeedFollow :one
-WITH feed_id AS (
+DELETE FROM feed_follows
+WHERE feed_follows.user_id = $1
+AND feed_follows.feed_id = (
 	SELECT feeds.id
 	FROM feeds
 	WHERE url = $2
 )
-DELETE FROM feed_follows 
-WHERE feed_follows.user_id = $1
-AND feed_id = feed_id
 RETURNING id, created_at, updated_at, user_id, feed_id
 `
 
@@ -104,23 +105,42 @@ func (q *Queries) DeleteFeedFollow(ctx context.Context, arg DeleteFeedFollowPara
 }
 
 const getFeedFollowsForUser = `-- name: GetFeedFollowsForUser :many
-SELECT users.name as user_name, feeds.name as feed_name, feed_follows.feed_id
+SELECT users.name as user_name, feeds.name as feed_name, feed_follows.feed_id,
+feeds.url as feed_url,
+ARRAY(
+	SELECT feed_follow_tags.tag
+	FROM feed_follow_tags
+	WHERE feed_follow_tags.feed_follow_id = feed_follows.id
+	ORDER BY feed_follow_tags.tag
+)::text[] as tags
 FROM feed_follows
 INNER JOIN users
 ON feed_follows.user_id = users.id
 INNER JOIN feeds
 ON feed_follows.feed_id = feeds.id
 WHERE users.name = $1
+AND ($2::text IS NULL OR EXISTS (
+	SELECT 1 FROM feed_follow_tags
+	WHERE feed_follow_tags.feed_follow_id = feed_follows.id
+	AND feed_follow_tags.tag = $2
+))
 `
 
+type GetFeedFollowsForUserParams struct {
+	Name string
+	Tag  sql.NullString
+}
+
 type GetFeedFollowsForUserRow struct {
 	UserName string
 	FeedName string
 	FeedID   uuid.UUID
+	FeedUrl  string
+	Tags     []string
 }
 
-func (q *Queries) GetFeedFollowsForUser(ctx context.Context, name string) ([]GetFeedFollowsForUserRow, error) {
-	rows, err := q.db.QueryContext(ctx, getFeedFollowsForUser, name)
+func (q *Queries) GetFeedFollowsForUser(ctx context.Context, arg GetFeedFollowsForUserParams) ([]GetFeedFollowsForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, getFeedFollowsForUser, arg.Name, arg.Tag)
 	if err != nil {
 		return nil, err
 	}
@@ -128,7 +148,13 @@ func (q *Queries) GetFeedFollowsForUser(ctx context.Context, name string) ([]Get
 	var items []GetFeedFollowsForUserRow
 	for rows.Next() {
 		var i GetFeedFollowsForUserRow
-		if err := rows.Scan(&i.UserName, &i.FeedName, &i.FeedID); err != nil {
+		if err := rows.Scan(
+			&i.UserName,
+			&i.FeedName,
+			&i.FeedID,
+			&i.FeedUrl,
+			pq.Array(&i.Tags),
+		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -141,3 +167,52 @@ func (q *Queries) GetFeedFollowsForUser(ctx context.Context, name string) ([]Get
 	}
 	return items, nil
 }
+
+const tagFeedFollow = `-- name: TagFeedFollow :execrows
+INSERT INTO feed_follow_tags (feed_follow_id, tag)
+SELECT feed_follows.id, $1
+FROM feed_follows
+INNER JOIN feeds
+ON feed_follows.feed_id = feeds.id
+WHERE feed_follows.user_id = $2
+AND feeds.url = $3
+ON CONFLICT (feed_follow_id, tag) DO NOTHING
+`
+
+type TagFeedFollowParams struct {
+	Tag    string
+	UserID uuid.UUID
+	Url    string
+}
+
+func (q *Queries) TagFeedFollow(ctx context.Context, arg TagFeedFollowParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, tagFeedFollow, arg.Tag, arg.UserID, arg.Url)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const untagFeedFollow = `-- name: UntagFeedFollow :execrows
+DELETE FROM feed_follow_tags
+USING feed_follows, feeds
+WHERE feed_follow_tags.feed_follow_id = feed_follows.id
+AND feed_follows.feed_id = feeds.id
+AND feed_follows.user_id = $1
+AND feeds.url = $2
+AND feed_follow_tags.tag = $3
+`
+
+type UntagFeedFollowParams struct {
+	UserID uuid.UUID
+	Url    string
+	Tag    string
+}
+
+func (q *Queries) UntagFeedFollow(ctx context.Context, arg UntagFeedFollowParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, untagFeedFollow, arg.UserID, arg.Url, arg.Tag)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -13,6 +13,66 @@ import (
 	"github.com/google/uuid"
 )
 
+const claimFeedsToFetch = `-- name: ClaimFeedsToFetch :many
+UPDATE feeds
+SET updated_at = $1, last_fetched_at = $1
+WHERE id IN (
+	SELECT stale.id FROM feeds AS stale
+	WHERE (stale.last_fetched_at IS NULL OR stale.last_fetched_at < $2)
+	AND (stale.next_fetch_at IS NULL OR stale.next_fetch_at <= $1)
+	ORDER BY stale.last_fetched_at ASC NULLS FIRST
+	LIMIT $3
+	FOR UPDATE SKIP LOCKED
+)
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, last_error, last_status, failure_count, next_fetch_at, refresh_interval_seconds, adaptive, publisher_interval_seconds
+`
+
+type ClaimFeedsToFetchParams struct {
+	UpdatedAt     time.Time
+	LastFetchedAt sql.NullTime
+	Limit         int32
+}
+
+func (q *Queries) ClaimFeedsToFetch(ctx context.Context, arg ClaimFeedsToFetchParams) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, claimFeedsToFetch, arg.UpdatedAt, arg.LastFetchedAt, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.LastFetchedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.LastError,
+			&i.LastStatus,
+			&i.FailureCount,
+			&i.NextFetchAt,
+			&i.RefreshIntervalSeconds,
+			&i.Adaptive,
+			&i.PublisherIntervalSeconds,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const createFeed = `-- name: CreateFeed :one
 INSERT INTO feeds(id, created_at, updated_at, name, url, user_id)
 VALUES (
@@ -23,7 +83,7 @@ VALUES (
 	$5,
 	$6
 )
-RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, last_error, last_status, failure_count, next_fetch_at, refresh_interval_seconds, adaptive, publisher_interval_seconds
 `
 
 type CreateFeedParams struct {
@@ -53,6 +113,15 @@ func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, e
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.LastError,
+		&i.LastStatus,
+		&i.FailureCount,
+		&i.NextFetchAt,
+		&i.RefreshIntervalSeconds,
+		&i.Adaptive,
+		&i.PublisherIntervalSeconds,
 	)
 	return i, err
 }
@@ -60,7 +129,7 @@ func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, e
 const deleteFeed = `-- name: DeleteFeed :one
 DELETE FROM feeds
 WHERE url = $1
-RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, last_error, last_status, failure_count, next_fetch_at, refresh_interval_seconds, adaptive, publisher_interval_seconds
 `
 
 func (q *Queries) DeleteFeed(ctx context.Context, url string) (Feed, error) {
@@ -74,12 +143,21 @@ func (q *Queries) DeleteFeed(ctx context.Context, url string) (Feed, error) {
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.LastError,
+		&i.LastStatus,
+		&i.FailureCount,
+		&i.NextFetchAt,
+		&i.RefreshIntervalSeconds,
+		&i.Adaptive,
+		&i.PublisherIntervalSeconds,
 	)
 	return i, err
 }
 
 const getFeed = `-- name: GetFeed :one
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at  FROM feeds
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, last_error, last_status, failure_count, next_fetch_at, refresh_interval_seconds, adaptive, publisher_interval_seconds  FROM feeds
 WHERE url = $1
 `
 
@@ -94,12 +172,52 @@ func (q *Queries) GetFeed(ctx context.Context, url string) (Feed, error) {
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.LastError,
+		&i.LastStatus,
+		&i.FailureCount,
+		&i.NextFetchAt,
+		&i.RefreshIntervalSeconds,
+		&i.Adaptive,
+		&i.PublisherIntervalSeconds,
 	)
 	return i, err
 }
 
+const getFeedPostingRate = `-- name: GetFeedPostingRate :one
+SELECT count(*)::int AS posts,
+min(recent.published_at)::timestamp AS oldest,
+max(recent.published_at)::timestamp AS newest
+FROM (
+	SELECT published_at FROM posts
+	WHERE feed_id = $1
+	AND published_at IS NOT NULL
+	AND (published_at_source IS NULL OR published_at_source NOT IN ('feed', 'fetched'))
+	ORDER BY published_at DESC
+	LIMIT 20
+) AS recent
+HAVING count(*) >= 2
+`
+
+type GetFeedPostingRateRow struct {
+	Posts  int32
+	Oldest time.Time
+	Newest time.Time
+}
+
+// looks at the feed's last 20 dated posts, guessed dates are left out since
+// they bunch up around fetch times. feeds with fewer than two have no rate and
+// return no row
+func (q *Queries) GetFeedPostingRate(ctx context.Context, feedID uuid.UUID) (GetFeedPostingRateRow, error) {
+	row := q.db.QueryRowContext(ctx, getFeedPostingRate, feedID)
+	var i GetFeedPostingRateRow
+	err := row.Scan(&i.Posts, &i.Oldest, &i.Newest)
+	return i, err
+}
+
 const getFeeds = `-- name: GetFeeds :many
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at FROM feeds
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, last_error, last_status, failure_count, next_fetch_at, refresh_interval_seconds, adaptive, publisher_interval_seconds FROM feeds
 ORDER BY created_at
 `
 
@@ -120,6 +238,15 @@ func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
 			&i.Url,
 			&i.UserID,
 			&i.LastFetchedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.LastError,
+			&i.LastStatus,
+			&i.FailureCount,
+			&i.NextFetchAt,
+			&i.RefreshIntervalSeconds,
+			&i.Adaptive,
+			&i.PublisherIntervalSeconds,
 		); err != nil {
 			return nil, err
 		}
@@ -169,39 +296,131 @@ func (q *Queries) GetFeedsUsers(ctx context.Context) ([]GetFeedsUsersRow, error)
 	return items, nil
 }
 
-const getNextFeedToFetch = `-- name: GetNextFeedToFetch :one
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at FROM feeds
-ORDER BY last_fetched_at ASC NULLS FIRST
-LIMIT 1
+const getUnhealthyFeeds = `-- name: GetUnhealthyFeeds :many
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, last_error, last_status, failure_count, next_fetch_at, refresh_interval_seconds, adaptive, publisher_interval_seconds FROM feeds
+WHERE failure_count > 0
+ORDER BY failure_count DESC, name
 `
 
-func (q *Queries) GetNextFeedToFetch(ctx context.Context) (Feed, error) {
-	row := q.db.QueryRowContext(ctx, getNextFeedToFetch)
-	var i Feed
-	err := row.Scan(
-		&i.ID,
-		&i.CreatedAt,
-		&i.UpdatedAt,
-		&i.Name,
-		&i.Url,
-		&i.UserID,
-		&i.LastFetchedAt,
+func (q *Queries) GetUnhealthyFeeds(ctx context.Context) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, getUnhealthyFeeds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.LastFetchedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.LastError,
+			&i.LastStatus,
+			&i.FailureCount,
+			&i.NextFetchAt,
+			&i.RefreshIntervalSeconds,
+			&i.Adaptive,
+			&i.PublisherIntervalSeconds,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markFeedFailed = `-- name: MarkFeedFailed :exec
+UPDATE feeds
+SET updated_at = $1, last_error = $2, last_status = $3,
+failure_count = failure_count + 1, next_fetch_at = $4
+WHERE id = $5
+`
+
+type MarkFeedFailedParams struct {
+	UpdatedAt   time.Time
+	LastError   sql.NullString
+	LastStatus  sql.NullInt32
+	NextFetchAt sql.NullTime
+	ID          uuid.UUID
+}
+
+func (q *Queries) MarkFeedFailed(ctx context.Context, arg MarkFeedFailedParams) error {
+	_, err := q.db.ExecContext(ctx, markFeedFailed,
+		arg.UpdatedAt,
+		arg.LastError,
+		arg.LastStatus,
+		arg.NextFetchAt,
+		arg.ID,
 	)
-	return i, err
+	return err
 }
 
 const markFeedFetched = `-- name: MarkFeedFetched :exec
 UPDATE feeds
-SET updated_at = $1, last_fetched_at = $1
-WHERE id = $2
+SET updated_at = $1, last_fetched_at = $1, etag = $2, last_modified = $3,
+last_status = $4, last_error = NULL, failure_count = 0, next_fetch_at = $5,
+publisher_interval_seconds = $6
+WHERE id = $7
 `
 
 type MarkFeedFetchedParams struct {
-	UpdatedAt time.Time
-	ID        uuid.UUID
+	UpdatedAt                time.Time
+	Etag                     sql.NullString
+	LastModified             sql.NullString
+	LastStatus               sql.NullInt32
+	NextFetchAt              sql.NullTime
+	PublisherIntervalSeconds sql.NullInt32
+	ID                       uuid.UUID
 }
 
 func (q *Queries) MarkFeedFetched(ctx context.Context, arg MarkFeedFetchedParams) error {
-	_, err := q.db.ExecContext(ctx, markFeedFetched, arg.UpdatedAt, arg.ID)
+	_, err := q.db.ExecContext(ctx, markFeedFetched,
+		arg.UpdatedAt,
+		arg.Etag,
+		arg.LastModified,
+		arg.LastStatus,
+		arg.NextFetchAt,
+		arg.PublisherIntervalSeconds,
+		arg.ID,
+	)
 	return err
 }
+
+const setFeedRefreshInterval = `-- name: SetFeedRefreshInterval :execrows
+UPDATE feeds
+SET updated_at = $1, refresh_interval_seconds = $2, adaptive = $3
+WHERE url = $4
+`
+
+type SetFeedRefreshIntervalParams struct {
+	UpdatedAt              time.Time
+	RefreshIntervalSeconds sql.NullInt32
+	Adaptive               bool
+	Url                    string
+}
+
+func (q *Queries) SetFeedRefreshInterval(ctx context.Context, arg SetFeedRefreshIntervalParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setFeedRefreshInterval,
+		arg.UpdatedAt,
+		arg.RefreshIntervalSeconds,
+		arg.Adaptive,
+		arg.Url,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
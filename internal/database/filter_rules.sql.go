@@ -0,0 +1,338 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.28.0
+// source: filter_rules.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const createFilterMatch = `-- name: CreateFilterMatch :execrows
+INSERT INTO filter_matches (rule_id, post_id)
+VALUES (
+	$1,
+	$2
+)
+ON CONFLICT (rule_id, post_id) DO NOTHING
+`
+
+type CreateFilterMatchParams struct {
+	RuleID uuid.UUID
+	PostID uuid.UUID
+}
+
+func (q *Queries) CreateFilterMatch(ctx context.Context, arg CreateFilterMatchParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, createFilterMatch, arg.RuleID, arg.PostID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const createFilterRule = `-- name: CreateFilterRule :one
+INSERT INTO filter_rules (id, created_at, user_id, mode, field, match_type, pattern, action, feed_id)
+VALUES (
+	$1,
+	$2,
+	$3,
+	$4,
+	$5,
+	$6,
+	$7,
+	$8,
+	$9
+)
+RETURNING id, created_at, user_id, mode, field, match_type, pattern, action, feed_id
+`
+
+type CreateFilterRuleParams struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	Mode      string
+	Field     string
+	MatchType string
+	Pattern   string
+	Action    string
+	FeedID    uuid.NullUUID
+}
+
+func (q *Queries) CreateFilterRule(ctx context.Context, arg CreateFilterRuleParams) (FilterRule, error) {
+	row := q.db.QueryRowContext(ctx, createFilterRule,
+		arg.ID,
+		arg.CreatedAt,
+		arg.UserID,
+		arg.Mode,
+		arg.Field,
+		arg.MatchType,
+		arg.Pattern,
+		arg.Action,
+		arg.FeedID,
+	)
+	var i FilterRule
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UserID,
+		&i.Mode,
+		&i.Field,
+		&i.MatchType,
+		&i.Pattern,
+		&i.Action,
+		&i.FeedID,
+	)
+	return i, err
+}
+
+const deleteFilterMatch = `-- name: DeleteFilterMatch :exec
+DELETE FROM filter_matches
+WHERE rule_id = $1 AND post_id = $2
+`
+
+type DeleteFilterMatchParams struct {
+	RuleID uuid.UUID
+	PostID uuid.UUID
+}
+
+func (q *Queries) DeleteFilterMatch(ctx context.Context, arg DeleteFilterMatchParams) error {
+	_, err := q.db.ExecContext(ctx, deleteFilterMatch, arg.RuleID, arg.PostID)
+	return err
+}
+
+const deleteFilterRule = `-- name: DeleteFilterRule :execrows
+DELETE FROM filter_rules
+WHERE user_id = $1 AND id = $2
+`
+
+type DeleteFilterRuleParams struct {
+	UserID uuid.UUID
+	ID     uuid.UUID
+}
+
+func (q *Queries) DeleteFilterRule(ctx context.Context, arg DeleteFilterRuleParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteFilterRule, arg.UserID, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getFilterRulesForFeed = `-- name: GetFilterRulesForFeed :many
+SELECT filter_rules.id, filter_rules.created_at, filter_rules.user_id, filter_rules.mode, filter_rules.field, filter_rules.match_type, filter_rules.pattern, filter_rules.action, filter_rules.feed_id
+FROM filter_rules
+INNER JOIN feed_follows
+ON filter_rules.user_id = feed_follows.user_id
+WHERE feed_follows.feed_id = $1
+AND (filter_rules.feed_id IS NULL OR filter_rules.feed_id = $1)
+`
+
+// every rule that applies to new posts in a feed, from each user following it
+func (q *Queries) GetFilterRulesForFeed(ctx context.Context, feedID uuid.UUID) ([]FilterRule, error) {
+	rows, err := q.db.QueryContext(ctx, getFilterRulesForFeed, feedID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []FilterRule
+	for rows.Next() {
+		var i FilterRule
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UserID,
+			&i.Mode,
+			&i.Field,
+			&i.MatchType,
+			&i.Pattern,
+			&i.Action,
+			&i.FeedID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getFilterRulesForUser = `-- name: GetFilterRulesForUser :many
+SELECT filter_rules.id, filter_rules.created_at, filter_rules.user_id, filter_rules.mode, filter_rules.field, filter_rules.match_type, filter_rules.pattern, filter_rules.action, filter_rules.feed_id, feeds.url AS feed_url
+FROM filter_rules
+LEFT JOIN feeds
+ON filter_rules.feed_id = feeds.id
+WHERE filter_rules.user_id = $1
+ORDER BY filter_rules.created_at
+`
+
+type GetFilterRulesForUserRow struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	Mode      string
+	Field     string
+	MatchType string
+	Pattern   string
+	Action    string
+	FeedID    uuid.NullUUID
+	FeedUrl   sql.NullString
+}
+
+func (q *Queries) GetFilterRulesForUser(ctx context.Context, userID uuid.UUID) ([]GetFilterRulesForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, getFilterRulesForUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetFilterRulesForUserRow
+	for rows.Next() {
+		var i GetFilterRulesForUserRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UserID,
+			&i.Mode,
+			&i.Field,
+			&i.MatchType,
+			&i.Pattern,
+			&i.Action,
+			&i.FeedID,
+			&i.FeedUrl,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getFilterRulesForUserFeed = `-- name: GetFilterRulesForUserFeed :many
+SELECT id, created_at, user_id, mode, field, match_type, pattern, action, feed_id FROM filter_rules
+WHERE user_id = $1
+AND (feed_id IS NULL OR feed_id = $2)
+`
+
+type GetFilterRulesForUserFeedParams struct {
+	UserID uuid.UUID
+	FeedID uuid.NullUUID
+}
+
+// the rules a user has that apply to a feed, for running them over the posts
+// it already has when the user follows it
+func (q *Queries) GetFilterRulesForUserFeed(ctx context.Context, arg GetFilterRulesForUserFeedParams) ([]FilterRule, error) {
+	rows, err := q.db.QueryContext(ctx, getFilterRulesForUserFeed, arg.UserID, arg.FeedID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []FilterRule
+	for rows.Next() {
+		var i FilterRule
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UserID,
+			&i.Mode,
+			&i.Field,
+			&i.MatchType,
+			&i.Pattern,
+			&i.Action,
+			&i.FeedID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPostsToFilter = `-- name: GetPostsToFilter :many
+SELECT posts.id, posts.title, posts.description, posts.author,
+ARRAY(
+	SELECT post_categories.category
+	FROM post_categories
+	WHERE post_categories.post_id = posts.id
+)::text[] AS categories
+FROM posts
+INNER JOIN feed_follows
+ON posts.feed_id = feed_follows.feed_id
+WHERE feed_follows.user_id = $1
+AND ($2::uuid IS NULL OR posts.feed_id = $2)
+AND posts.id > $3::uuid
+ORDER BY posts.id
+LIMIT $4
+`
+
+type GetPostsToFilterParams struct {
+	UserID uuid.UUID
+	FeedID uuid.NullUUID
+	After  uuid.UUID
+	Limit  int32
+}
+
+type GetPostsToFilterRow struct {
+	ID          uuid.UUID
+	Title       sql.NullString
+	Description sql.NullString
+	Author      sql.NullString
+	Categories  []string
+}
+
+// a batch of the posts already stored for the feeds a user follows, walked in
+// id order so new rules can be run over them without loading them all at once
+func (q *Queries) GetPostsToFilter(ctx context.Context, arg GetPostsToFilterParams) ([]GetPostsToFilterRow, error) {
+	rows, err := q.db.QueryContext(ctx, getPostsToFilter,
+		arg.UserID,
+		arg.FeedID,
+		arg.After,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetPostsToFilterRow
+	for rows.Next() {
+		var i GetPostsToFilterRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Title,
+			&i.Description,
+			&i.Author,
+			pq.Array(&i.Categories),
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
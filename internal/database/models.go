@@ -12,13 +12,22 @@ import (
 )
 
 type Feed struct {
-	ID            uuid.UUID
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
-	Name          string
-	Url           string
-	UserID        uuid.UUID
-	LastFetchedAt sql.NullTime
+	ID                       uuid.UUID
+	CreatedAt                time.Time
+	UpdatedAt                time.Time
+	Name                     string
+	Url                      string
+	UserID                   uuid.UUID
+	LastFetchedAt            sql.NullTime
+	Etag                     sql.NullString
+	LastModified             sql.NullString
+	LastError                sql.NullString
+	LastStatus               sql.NullInt32
+	FailureCount             int32
+	NextFetchAt              sql.NullTime
+	RefreshIntervalSeconds   sql.NullInt32
+	Adaptive                 bool
+	PublisherIntervalSeconds sql.NullInt32
 }
 
 type FeedFollow struct {
@@ -29,20 +38,123 @@ type FeedFollow struct {
 	FeedID    uuid.UUID
 }
 
+type FeedFollowTag struct {
+	FeedFollowID uuid.UUID
+	Tag          string
+}
+
+type FilterMatch struct {
+	RuleID uuid.UUID
+	PostID uuid.UUID
+}
+
+type FilterRule struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	Mode      string
+	Field     string
+	MatchType string
+	Pattern   string
+	Action    string
+	FeedID    uuid.NullUUID
+}
+
+type NotificationDelivery struct {
+	TargetID      uuid.UUID
+	PostID        uuid.UUID
+	CreatedAt     time.Time
+	Status        string
+	Attempts      int32
+	LastError     sql.NullString
+	NextAttemptAt time.Time
+	DeliveredAt   sql.NullTime
+}
+
+type NotificationTarget struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uuid.UUID
+	Name      string
+	Kind      string
+	Url       string
+	EmailFrom sql.NullString
+	EmailTo   sql.NullString
+	FeedID    uuid.NullUUID
+	Tag       sql.NullString
+}
+
 type Post struct {
+	ID                uuid.UUID
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	Title             sql.NullString
+	Url               string
+	Description       sql.NullString
+	PublishedAt       sql.NullTime
+	FeedID            uuid.UUID
+	Search            interface{}
+	PublishedAtSource sql.NullString
+	Content           sql.NullString
+	Author            sql.NullString
+	Guid              sql.NullString
+	GuidIsPermalink   sql.NullBool
+	CommentsUrl       sql.NullString
+	ItemKey           string
+	ContentHash       sql.NullString
+	ImageUrl          sql.NullString
+}
+
+type PostCategory struct {
+	PostID   uuid.UUID
+	Category string
+}
+
+type PostEnclosure struct {
+	ID              uuid.UUID
+	PostID          uuid.UUID
+	Url             string
+	MimeType        sql.NullString
+	Length          sql.NullInt64
+	DurationSeconds sql.NullInt32
+	Checksum        sql.NullString
+}
+
+type PostRead struct {
+	UserID uuid.UUID
+	PostID uuid.UUID
+	ReadAt time.Time
+}
+
+type PostRevision struct {
 	ID          uuid.UUID
+	PostID      uuid.UUID
 	CreatedAt   time.Time
-	UpdatedAt   time.Time
+	ReplacedAt  time.Time
+	Title       sql.NullString
+	Url         string
+	Description sql.NullString
+	Content     sql.NullString
+	ContentHash sql.NullString
+}
+
+type SavedPost struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UserID      uuid.UUID
+	PostID      uuid.NullUUID
 	Title       sql.NullString
 	Url         string
 	Description sql.NullString
 	PublishedAt sql.NullTime
-	FeedID      uuid.UUID
+	FeedName    string
 }
 
 type User struct {
-	ID        uuid.UUID
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	Name      string
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	Name       string
+	ApiKeyHash sql.NullString
 }
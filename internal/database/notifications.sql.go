@@ -0,0 +1,437 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.28.0
+// source: notifications.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const claimDueDeliveries = `-- name: ClaimDueDeliveries :many
+UPDATE notification_deliveries
+SET next_attempt_at = $1
+WHERE (target_id, post_id) IN (
+	SELECT due.target_id, due.post_id FROM notification_deliveries AS due
+	WHERE due.status = 'pending'
+	AND due.next_attempt_at <= $2
+	ORDER BY due.created_at
+	LIMIT $3
+	FOR UPDATE SKIP LOCKED
+)
+RETURNING target_id, post_id, created_at, status, attempts, last_error, next_attempt_at, delivered_at
+`
+
+type ClaimDueDeliveriesParams struct {
+	LeaseUntil time.Time
+	Now        time.Time
+	Limit      int32
+}
+
+// pushes next_attempt_at out by the lease so another agg process won't pick
+// the same deliveries up while these are being sent
+func (q *Queries) ClaimDueDeliveries(ctx context.Context, arg ClaimDueDeliveriesParams) ([]NotificationDelivery, error) {
+	rows, err := q.db.QueryContext(ctx, claimDueDeliveries, arg.LeaseUntil, arg.Now, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []NotificationDelivery
+	for rows.Next() {
+		var i NotificationDelivery
+		if err := rows.Scan(
+			&i.TargetID,
+			&i.PostID,
+			&i.CreatedAt,
+			&i.Status,
+			&i.Attempts,
+			&i.LastError,
+			&i.NextAttemptAt,
+			&i.DeliveredAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const createNotificationTarget = `-- name: CreateNotificationTarget :one
+INSERT INTO notification_targets (id, created_at, updated_at, user_id, name, kind, url, email_from, email_to, feed_id, tag)
+VALUES (
+	$1,
+	$2,
+	$3,
+	$4,
+	$5,
+	$6,
+	$7,
+	$8,
+	$9,
+	$10,
+	$11
+)
+RETURNING id, created_at, updated_at, user_id, name, kind, url, email_from, email_to, feed_id, tag
+`
+
+type CreateNotificationTargetParams struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uuid.UUID
+	Name      string
+	Kind      string
+	Url       string
+	EmailFrom sql.NullString
+	EmailTo   sql.NullString
+	FeedID    uuid.NullUUID
+	Tag       sql.NullString
+}
+
+func (q *Queries) CreateNotificationTarget(ctx context.Context, arg CreateNotificationTargetParams) (NotificationTarget, error) {
+	row := q.db.QueryRowContext(ctx, createNotificationTarget,
+		arg.ID,
+		arg.CreatedAt,
+		arg.UpdatedAt,
+		arg.UserID,
+		arg.Name,
+		arg.Kind,
+		arg.Url,
+		arg.EmailFrom,
+		arg.EmailTo,
+		arg.FeedID,
+		arg.Tag,
+	)
+	var i NotificationTarget
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Name,
+		&i.Kind,
+		&i.Url,
+		&i.EmailFrom,
+		&i.EmailTo,
+		&i.FeedID,
+		&i.Tag,
+	)
+	return i, err
+}
+
+const deleteNotificationTarget = `-- name: DeleteNotificationTarget :execrows
+DELETE FROM notification_targets
+WHERE user_id = $1 AND name = $2
+`
+
+type DeleteNotificationTargetParams struct {
+	UserID uuid.UUID
+	Name   string
+}
+
+func (q *Queries) DeleteNotificationTarget(ctx context.Context, arg DeleteNotificationTargetParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteNotificationTarget, arg.UserID, arg.Name)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getDeliveryLog = `-- name: GetDeliveryLog :many
+SELECT notification_targets.name AS target_name, posts.title, posts.url,
+notification_deliveries.status, notification_deliveries.attempts, notification_deliveries.last_error,
+notification_deliveries.created_at, notification_deliveries.delivered_at
+FROM notification_deliveries
+INNER JOIN notification_targets
+ON notification_deliveries.target_id = notification_targets.id
+INNER JOIN posts
+ON notification_deliveries.post_id = posts.id
+WHERE notification_targets.user_id = $1
+ORDER BY notification_deliveries.created_at DESC
+LIMIT $2
+`
+
+type GetDeliveryLogParams struct {
+	UserID uuid.UUID
+	Limit  int32
+}
+
+type GetDeliveryLogRow struct {
+	TargetName  string
+	Title       sql.NullString
+	Url         string
+	Status      string
+	Attempts    int32
+	LastError   sql.NullString
+	CreatedAt   time.Time
+	DeliveredAt sql.NullTime
+}
+
+func (q *Queries) GetDeliveryLog(ctx context.Context, arg GetDeliveryLogParams) ([]GetDeliveryLogRow, error) {
+	rows, err := q.db.QueryContext(ctx, getDeliveryLog, arg.UserID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetDeliveryLogRow
+	for rows.Next() {
+		var i GetDeliveryLogRow
+		if err := rows.Scan(
+			&i.TargetName,
+			&i.Title,
+			&i.Url,
+			&i.Status,
+			&i.Attempts,
+			&i.LastError,
+			&i.CreatedAt,
+			&i.DeliveredAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getNotificationPosts = `-- name: GetNotificationPosts :many
+SELECT posts.id, posts.title, posts.url, posts.description, posts.published_at, posts.author,
+feeds.name AS feed_name
+FROM posts
+INNER JOIN feeds
+ON posts.feed_id = feeds.id
+WHERE posts.id = ANY($1::uuid[])
+ORDER BY posts.published_at NULLS LAST
+`
+
+type GetNotificationPostsRow struct {
+	ID          uuid.UUID
+	Title       sql.NullString
+	Url         string
+	Description sql.NullString
+	PublishedAt sql.NullTime
+	Author      sql.NullString
+	FeedName    string
+}
+
+func (q *Queries) GetNotificationPosts(ctx context.Context, postIds []uuid.UUID) ([]GetNotificationPostsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getNotificationPosts, pq.Array(postIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetNotificationPostsRow
+	for rows.Next() {
+		var i GetNotificationPostsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Title,
+			&i.Url,
+			&i.Description,
+			&i.PublishedAt,
+			&i.Author,
+			&i.FeedName,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getNotificationTarget = `-- name: GetNotificationTarget :one
+SELECT id, created_at, updated_at, user_id, name, kind, url, email_from, email_to, feed_id, tag FROM notification_targets
+WHERE id = $1
+`
+
+func (q *Queries) GetNotificationTarget(ctx context.Context, id uuid.UUID) (NotificationTarget, error) {
+	row := q.db.QueryRowContext(ctx, getNotificationTarget, id)
+	var i NotificationTarget
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Name,
+		&i.Kind,
+		&i.Url,
+		&i.EmailFrom,
+		&i.EmailTo,
+		&i.FeedID,
+		&i.Tag,
+	)
+	return i, err
+}
+
+const getNotificationTargetsForUser = `-- name: GetNotificationTargetsForUser :many
+SELECT notification_targets.id, notification_targets.created_at, notification_targets.updated_at, notification_targets.user_id, notification_targets.name, notification_targets.kind, notification_targets.url, notification_targets.email_from, notification_targets.email_to, notification_targets.feed_id, notification_targets.tag, feeds.url AS feed_url
+FROM notification_targets
+LEFT JOIN feeds
+ON notification_targets.feed_id = feeds.id
+WHERE notification_targets.user_id = $1
+ORDER BY notification_targets.name
+`
+
+type GetNotificationTargetsForUserRow struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uuid.UUID
+	Name      string
+	Kind      string
+	Url       string
+	EmailFrom sql.NullString
+	EmailTo   sql.NullString
+	FeedID    uuid.NullUUID
+	Tag       sql.NullString
+	FeedUrl   sql.NullString
+}
+
+func (q *Queries) GetNotificationTargetsForUser(ctx context.Context, userID uuid.UUID) ([]GetNotificationTargetsForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, getNotificationTargetsForUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetNotificationTargetsForUserRow
+	for rows.Next() {
+		var i GetNotificationTargetsForUserRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.Name,
+			&i.Kind,
+			&i.Url,
+			&i.EmailFrom,
+			&i.EmailTo,
+			&i.FeedID,
+			&i.Tag,
+			&i.FeedUrl,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markDeliveriesDelivered = `-- name: MarkDeliveriesDelivered :exec
+UPDATE notification_deliveries
+SET status = 'delivered', attempts = attempts + 1, last_error = NULL, delivered_at = $1
+WHERE target_id = $2
+AND post_id = ANY($3::uuid[])
+`
+
+type MarkDeliveriesDeliveredParams struct {
+	DeliveredAt sql.NullTime
+	TargetID    uuid.UUID
+	PostIds     []uuid.UUID
+}
+
+func (q *Queries) MarkDeliveriesDelivered(ctx context.Context, arg MarkDeliveriesDeliveredParams) error {
+	_, err := q.db.ExecContext(ctx, markDeliveriesDelivered, arg.DeliveredAt, arg.TargetID, pq.Array(arg.PostIds))
+	return err
+}
+
+const markDeliveriesFailed = `-- name: MarkDeliveriesFailed :exec
+UPDATE notification_deliveries
+SET attempts = attempts + 1,
+last_error = $1,
+next_attempt_at = $2,
+status = CASE WHEN attempts + 1 >= $3::int THEN 'failed' ELSE 'pending' END
+WHERE target_id = $4
+AND post_id = ANY($5::uuid[])
+`
+
+type MarkDeliveriesFailedParams struct {
+	LastError     sql.NullString
+	NextAttemptAt time.Time
+	MaxAttempts   int32
+	TargetID      uuid.UUID
+	PostIds       []uuid.UUID
+}
+
+// deliveries that have used up their attempts stop being retried
+func (q *Queries) MarkDeliveriesFailed(ctx context.Context, arg MarkDeliveriesFailedParams) error {
+	_, err := q.db.ExecContext(ctx, markDeliveriesFailed,
+		arg.LastError,
+		arg.NextAttemptAt,
+		arg.MaxAttempts,
+		arg.TargetID,
+		pq.Array(arg.PostIds),
+	)
+	return err
+}
+
+const queuePostNotifications = `-- name: QueuePostNotifications :execrows
+INSERT INTO notification_deliveries (target_id, post_id, created_at, next_attempt_at)
+SELECT notification_targets.id, posts.id, $1, $1
+FROM posts
+INNER JOIN notification_targets
+ON notification_targets.feed_id = posts.feed_id
+OR EXISTS (
+	SELECT 1 FROM feed_follows
+	INNER JOIN feed_follow_tags
+	ON feed_follow_tags.feed_follow_id = feed_follows.id
+	WHERE feed_follows.user_id = notification_targets.user_id
+	AND feed_follows.feed_id = posts.feed_id
+	AND feed_follow_tags.tag = notification_targets.tag
+)
+WHERE posts.id = ANY($2::uuid[])
+AND NOT EXISTS (
+	SELECT 1 FROM filter_matches
+	INNER JOIN filter_rules
+	ON filter_matches.rule_id = filter_rules.id
+	WHERE filter_matches.post_id = posts.id
+	AND filter_rules.user_id = notification_targets.user_id
+	AND filter_rules.action = 'hide'
+)
+ON CONFLICT (target_id, post_id) DO NOTHING
+`
+
+type QueuePostNotificationsParams struct {
+	CreatedAt time.Time
+	PostIds   []uuid.UUID
+}
+
+// queues the new posts for every target watching their feed, either directly
+// or through a tag on the target owner's follow. posts the target's owner has
+// a hide rule for are left out
+func (q *Queries) QueuePostNotifications(ctx context.Context, arg QueuePostNotificationsParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, queuePostNotifications, arg.CreatedAt, pq.Array(arg.PostIds))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,127 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.28.0
+// source: post_enclosures.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const createPostEnclosure = `-- name: CreatePostEnclosure :exec
+INSERT INTO post_enclosures (id, post_id, url, mime_type, length, duration_seconds, checksum)
+VALUES (
+	$1,
+	$2,
+	$3,
+	$4,
+	$5,
+	$6,
+	$7
+)
+ON CONFLICT (post_id, url) DO UPDATE
+SET mime_type = excluded.mime_type,
+length = excluded.length,
+duration_seconds = excluded.duration_seconds,
+checksum = coalesce(excluded.checksum, post_enclosures.checksum)
+`
+
+type CreatePostEnclosureParams struct {
+	ID              uuid.UUID
+	PostID          uuid.UUID
+	Url             string
+	MimeType        sql.NullString
+	Length          sql.NullInt64
+	DurationSeconds sql.NullInt32
+	Checksum        sql.NullString
+}
+
+// enclosures of edited posts are saved again, a checksum recorded by download
+// is kept unless the feed now gives one
+func (q *Queries) CreatePostEnclosure(ctx context.Context, arg CreatePostEnclosureParams) error {
+	_, err := q.db.ExecContext(ctx, createPostEnclosure,
+		arg.ID,
+		arg.PostID,
+		arg.Url,
+		arg.MimeType,
+		arg.Length,
+		arg.DurationSeconds,
+		arg.Checksum,
+	)
+	return err
+}
+
+const deleteStalePostEnclosures = `-- name: DeleteStalePostEnclosures :exec
+DELETE FROM post_enclosures
+WHERE post_id = $1
+AND NOT (url = ANY($2::text[]))
+`
+
+type DeleteStalePostEnclosuresParams struct {
+	PostID uuid.UUID
+	Urls   []string
+}
+
+// removes the enclosures an edited post no longer has
+func (q *Queries) DeleteStalePostEnclosures(ctx context.Context, arg DeleteStalePostEnclosuresParams) error {
+	_, err := q.db.ExecContext(ctx, deleteStalePostEnclosures, arg.PostID, pq.Array(arg.Urls))
+	return err
+}
+
+const getEnclosuresForPosts = `-- name: GetEnclosuresForPosts :many
+SELECT id, post_id, url, mime_type, length, duration_seconds, checksum FROM post_enclosures
+WHERE post_id = ANY($1::uuid[])
+ORDER BY post_id, url
+`
+
+func (q *Queries) GetEnclosuresForPosts(ctx context.Context, postIds []uuid.UUID) ([]PostEnclosure, error) {
+	rows, err := q.db.QueryContext(ctx, getEnclosuresForPosts, pq.Array(postIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []PostEnclosure
+	for rows.Next() {
+		var i PostEnclosure
+		if err := rows.Scan(
+			&i.ID,
+			&i.PostID,
+			&i.Url,
+			&i.MimeType,
+			&i.Length,
+			&i.DurationSeconds,
+			&i.Checksum,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setEnclosureChecksum = `-- name: SetEnclosureChecksum :exec
+UPDATE post_enclosures
+SET checksum = $2
+WHERE id = $1
+`
+
+type SetEnclosureChecksumParams struct {
+	ID       uuid.UUID
+	Checksum sql.NullString
+}
+
+func (q *Queries) SetEnclosureChecksum(ctx context.Context, arg SetEnclosureChecksumParams) error {
+	_, err := q.db.ExecContext(ctx, setEnclosureChecksum, arg.ID, arg.Checksum)
+	return err
+}
@@ -0,0 +1,101 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.28.0
+// source: post_reads.sql
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const markFeedPostsRead = `-- name: MarkFeedPostsRead :execrows
+INSERT INTO post_reads (user_id, post_id, read_at)
+SELECT $1, posts.id, $2
+FROM posts
+INNER JOIN feeds
+ON posts.feed_id = feeds.id
+WHERE feeds.url = $3
+ON CONFLICT (user_id, post_id) DO NOTHING
+`
+
+type MarkFeedPostsReadParams struct {
+	UserID uuid.UUID
+	ReadAt time.Time
+	Url    string
+}
+
+func (q *Queries) MarkFeedPostsRead(ctx context.Context, arg MarkFeedPostsReadParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, markFeedPostsRead, arg.UserID, arg.ReadAt, arg.Url)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const markFeedPostsUnread = `-- name: MarkFeedPostsUnread :execrows
+DELETE FROM post_reads
+USING posts, feeds
+WHERE post_reads.post_id = posts.id
+AND posts.feed_id = feeds.id
+AND post_reads.user_id = $1
+AND feeds.url = $2
+`
+
+type MarkFeedPostsUnreadParams struct {
+	UserID uuid.UUID
+	Url    string
+}
+
+func (q *Queries) MarkFeedPostsUnread(ctx context.Context, arg MarkFeedPostsUnreadParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, markFeedPostsUnread, arg.UserID, arg.Url)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const markPostRead = `-- name: MarkPostRead :execrows
+INSERT INTO post_reads (user_id, post_id, read_at)
+VALUES (
+	$1,
+	$2,
+	$3
+)
+ON CONFLICT (user_id, post_id) DO NOTHING
+`
+
+type MarkPostReadParams struct {
+	UserID uuid.UUID
+	PostID uuid.UUID
+	ReadAt time.Time
+}
+
+func (q *Queries) MarkPostRead(ctx context.Context, arg MarkPostReadParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, markPostRead, arg.UserID, arg.PostID, arg.ReadAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const markPostUnread = `-- name: MarkPostUnread :execrows
+DELETE FROM post_reads
+WHERE user_id = $1 AND post_id = $2
+`
+
+type MarkPostUnreadParams struct {
+	UserID uuid.UUID
+	PostID uuid.UUID
+}
+
+func (q *Queries) MarkPostUnread(ctx context.Context, arg MarkPostUnreadParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, markPostUnread, arg.UserID, arg.PostID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
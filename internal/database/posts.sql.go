@@ -11,10 +11,49 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const adoptLegacyPost = `-- name: AdoptLegacyPost :execrows
+UPDATE posts
+SET item_key = $1, guid = $1, guid_is_permalink = $2
+WHERE posts.feed_id = $3
+AND posts.item_key = $4
+AND posts.guid IS NULL
+AND NOT EXISTS (
+	SELECT 1 FROM posts AS other
+	WHERE other.feed_id = $3
+	AND other.item_key = $1
+)
+`
+
+type AdoptLegacyPostParams struct {
+	Guid            string
+	GuidIsPermalink sql.NullBool
+	FeedID          uuid.UUID
+	Url             string
+}
+
+// posts saved before guids were stored were keyed on their link by the
+// migration, the first fetch that sees the item's guid moves the post over to
+// it so it isn't saved a second time. nothing happens if another post already
+// has the guid as its key
+func (q *Queries) AdoptLegacyPost(ctx context.Context, arg AdoptLegacyPostParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, adoptLegacyPost,
+		arg.Guid,
+		arg.GuidIsPermalink,
+		arg.FeedID,
+		arg.Url,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const createPost = `-- name: CreatePost :one
-INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id)
+INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id, published_at_source,
+content, author, guid, guid_is_permalink, comments_url, item_key, content_hash, image_url)
 VALUES (
 	$1,
 	$2,
@@ -23,20 +62,38 @@ VALUES (
 	$5,
 	$6,
 	$7,
-	$8
+	$8,
+	$9,
+	$10,
+	$11,
+	$12,
+	$13,
+	$14,
+	$15,
+	$16,
+	$17
 )
-RETURNING id, created_at, updated_at, title, url, description, published_at, feed_id
+RETURNING id, created_at, updated_at, title, url, description, published_at, feed_id, search, published_at_source, content, author, guid, guid_is_permalink, comments_url, item_key, content_hash, image_url
 `
 
 type CreatePostParams struct {
-	ID          uuid.UUID
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	Title       sql.NullString
-	Url         string
-	Description sql.NullString
-	PublishedAt sql.NullTime
-	FeedID      uuid.UUID
+	ID                uuid.UUID
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	Title             sql.NullString
+	Url               string
+	Description       sql.NullString
+	PublishedAt       sql.NullTime
+	FeedID            uuid.UUID
+	PublishedAtSource sql.NullString
+	Content           sql.NullString
+	Author            sql.NullString
+	Guid              sql.NullString
+	GuidIsPermalink   sql.NullBool
+	CommentsUrl       sql.NullString
+	ItemKey           string
+	ContentHash       sql.NullString
+	ImageUrl          sql.NullString
 }
 
 func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, error) {
@@ -49,6 +106,15 @@ func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, e
 		arg.Description,
 		arg.PublishedAt,
 		arg.FeedID,
+		arg.PublishedAtSource,
+		arg.Content,
+		arg.Author,
+		arg.Guid,
+		arg.GuidIsPermalink,
+		arg.CommentsUrl,
+		arg.ItemKey,
+		arg.ContentHash,
+		arg.ImageUrl,
 	)
 	var i Post
 	err := row.Scan(
@@ -60,49 +126,435 @@ func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, e
 		&i.Description,
 		&i.PublishedAt,
 		&i.FeedID,
+		&i.Search,
+		&i.PublishedAtSource,
+		&i.Content,
+		&i.Author,
+		&i.Guid,
+		&i.GuidIsPermalink,
+		&i.CommentsUrl,
+		&i.ItemKey,
+		&i.ContentHash,
+		&i.ImageUrl,
 	)
 	return i, err
 }
 
-const getPostsForUser = `-- name: GetPostsForUser :many
-SELECT posts.title, posts.url, posts.description, posts.published_at, feeds.name as feed_name FROM posts
+const createPostCategory = `-- name: CreatePostCategory :exec
+INSERT INTO post_categories (post_id, category)
+VALUES (
+	$1,
+	$2
+)
+ON CONFLICT (post_id, category) DO NOTHING
+`
+
+type CreatePostCategoryParams struct {
+	PostID   uuid.UUID
+	Category string
+}
+
+func (q *Queries) CreatePostCategory(ctx context.Context, arg CreatePostCategoryParams) error {
+	_, err := q.db.ExecContext(ctx, createPostCategory, arg.PostID, arg.Category)
+	return err
+}
+
+const deleteStalePostCategories = `-- name: DeleteStalePostCategories :exec
+DELETE FROM post_categories
+WHERE post_id = $1
+AND NOT (category = ANY($2::text[]))
+`
+
+type DeleteStalePostCategoriesParams struct {
+	PostID     uuid.UUID
+	Categories []string
+}
+
+// removes the categories an edited post no longer has
+func (q *Queries) DeleteStalePostCategories(ctx context.Context, arg DeleteStalePostCategoriesParams) error {
+	_, err := q.db.ExecContext(ctx, deleteStalePostCategories, arg.PostID, pq.Array(arg.Categories))
+	return err
+}
+
+const getPostByID = `-- name: GetPostByID :one
+SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.search, posts.published_at_source, posts.content, posts.author, posts.guid, posts.guid_is_permalink, posts.comments_url, posts.item_key, posts.content_hash, posts.image_url, feeds.name AS feed_name
+FROM posts
+INNER JOIN feeds
+ON posts.feed_id = feeds.id
+WHERE posts.id = $1
+`
+
+type GetPostByIDRow struct {
+	ID                uuid.UUID
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	Title             sql.NullString
+	Url               string
+	Description       sql.NullString
+	PublishedAt       sql.NullTime
+	FeedID            uuid.UUID
+	Search            interface{}
+	PublishedAtSource sql.NullString
+	Content           sql.NullString
+	Author            sql.NullString
+	Guid              sql.NullString
+	GuidIsPermalink   sql.NullBool
+	CommentsUrl       sql.NullString
+	ItemKey           string
+	ContentHash       sql.NullString
+	ImageUrl          sql.NullString
+	FeedName          string
+}
+
+func (q *Queries) GetPostByID(ctx context.Context, id uuid.UUID) (GetPostByIDRow, error) {
+	row := q.db.QueryRowContext(ctx, getPostByID, id)
+	var i GetPostByIDRow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Title,
+		&i.Url,
+		&i.Description,
+		&i.PublishedAt,
+		&i.FeedID,
+		&i.Search,
+		&i.PublishedAtSource,
+		&i.Content,
+		&i.Author,
+		&i.Guid,
+		&i.GuidIsPermalink,
+		&i.CommentsUrl,
+		&i.ItemKey,
+		&i.ContentHash,
+		&i.ImageUrl,
+		&i.FeedName,
+	)
+	return i, err
+}
+
+const getPostByUrl = `-- name: GetPostByUrl :one
+SELECT id, created_at, updated_at, title, url, description, published_at, feed_id, search, published_at_source, content, author, guid, guid_is_permalink, comments_url, item_key, content_hash, image_url FROM posts
+WHERE url = $1
+ORDER BY created_at
+LIMIT 1
+`
+
+// several feeds can carry the same link, the oldest post wins
+func (q *Queries) GetPostByUrl(ctx context.Context, url string) (Post, error) {
+	row := q.db.QueryRowContext(ctx, getPostByUrl, url)
+	var i Post
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Title,
+		&i.Url,
+		&i.Description,
+		&i.PublishedAt,
+		&i.FeedID,
+		&i.Search,
+		&i.PublishedAtSource,
+		&i.Content,
+		&i.Author,
+		&i.Guid,
+		&i.GuidIsPermalink,
+		&i.CommentsUrl,
+		&i.ItemKey,
+		&i.ContentHash,
+		&i.ImageUrl,
+	)
+	return i, err
+}
+
+const getPostsForUserByFetched = `-- name: GetPostsForUserByFetched :many
+SELECT posts.id, posts.title, posts.url, posts.description, posts.published_at, posts.created_at,
+feeds.name as feed_name, post_reads.read_at, posts.author, posts.image_url,
+EXISTS (
+	SELECT 1 FROM filter_matches
+	INNER JOIN filter_rules
+	ON filter_matches.rule_id = filter_rules.id
+	WHERE filter_matches.post_id = posts.id
+	AND filter_rules.user_id = feed_follows.user_id
+	AND filter_rules.action = 'highlight'
+) AS highlighted,
+ARRAY(
+	SELECT post_categories.category
+	FROM post_categories
+	WHERE post_categories.post_id = posts.id
+	ORDER BY post_categories.category
+)::text[] as categories
+FROM posts
+INNER JOIN feed_follows
+ON posts.feed_id = feed_follows.feed_id
+INNER JOIN feeds
+ON posts.feed_id = feeds.id
+LEFT JOIN post_reads
+ON posts.id = post_reads.post_id
+AND post_reads.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = $1
+AND ($2::bool OR post_reads.read_at IS NULL)
+AND ($3::bool OR NOT EXISTS (
+	SELECT 1 FROM filter_matches
+	INNER JOIN filter_rules
+	ON filter_matches.rule_id = filter_rules.id
+	WHERE filter_matches.post_id = posts.id
+	AND filter_rules.user_id = feed_follows.user_id
+	AND filter_rules.action = 'hide'
+))
+AND ($4::uuid IS NULL OR posts.feed_id = $4)
+AND ($5::text IS NULL OR EXISTS (
+	SELECT 1 FROM feed_follow_tags
+	WHERE feed_follow_tags.feed_follow_id = feed_follows.id
+	AND feed_follow_tags.tag = $5
+))
+AND ($6::text IS NULL OR posts.author ILIKE '%' || $6 || '%')
+AND ($7::text IS NULL OR EXISTS (
+	SELECT 1 FROM post_categories
+	WHERE post_categories.post_id = posts.id
+	AND lower(post_categories.category) = lower($7)
+))
+AND (NOT $8::bool OR EXISTS (
+	SELECT 1 FROM post_enclosures
+	WHERE post_enclosures.post_id = posts.id
+))
+AND ($9::timestamp IS NULL OR posts.created_at >= $9)
+AND ($10::timestamp IS NULL OR posts.created_at < $10)
+AND ($11::timestamp IS NULL OR CASE WHEN $12::bool
+	THEN (posts.created_at, posts.id) < ($11, $13::uuid)
+	ELSE (posts.created_at, posts.id) > ($11, $13::uuid)
+END)
+ORDER BY
+CASE WHEN $12::bool THEN posts.created_at END DESC,
+CASE WHEN $12::bool THEN posts.id END DESC,
+posts.created_at ASC,
+posts.id ASC
+LIMIT $14
+`
+
+type GetPostsForUserByFetchedParams struct {
+	UserID        uuid.UUID
+	IncludeRead   bool
+	IncludeHidden bool
+	FeedID        uuid.NullUUID
+	Tag           sql.NullString
+	Author        sql.NullString
+	Category      sql.NullString
+	MediaOnly     bool
+	Since         sql.NullTime
+	Until         sql.NullTime
+	CursorKey     sql.NullTime
+	Descending    bool
+	CursorID      uuid.NullUUID
+	Limit         int32
+}
+
+type GetPostsForUserByFetchedRow struct {
+	ID          uuid.UUID
+	Title       sql.NullString
+	Url         string
+	Description sql.NullString
+	PublishedAt sql.NullTime
+	CreatedAt   time.Time
+	FeedName    string
+	ReadAt      sql.NullTime
+	Author      sql.NullString
+	ImageUrl    sql.NullString
+	Highlighted bool
+	Categories  []string
+}
+
+// the same as GetPostsForUserByPublished but sorted on when the post was
+// fetched, the two have to select the same columns
+func (q *Queries) GetPostsForUserByFetched(ctx context.Context, arg GetPostsForUserByFetchedParams) ([]GetPostsForUserByFetchedRow, error) {
+	rows, err := q.db.QueryContext(ctx, getPostsForUserByFetched,
+		arg.UserID,
+		arg.IncludeRead,
+		arg.IncludeHidden,
+		arg.FeedID,
+		arg.Tag,
+		arg.Author,
+		arg.Category,
+		arg.MediaOnly,
+		arg.Since,
+		arg.Until,
+		arg.CursorKey,
+		arg.Descending,
+		arg.CursorID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetPostsForUserByFetchedRow
+	for rows.Next() {
+		var i GetPostsForUserByFetchedRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Title,
+			&i.Url,
+			&i.Description,
+			&i.PublishedAt,
+			&i.CreatedAt,
+			&i.FeedName,
+			&i.ReadAt,
+			&i.Author,
+			&i.ImageUrl,
+			&i.Highlighted,
+			pq.Array(&i.Categories),
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPostsForUserByPublished = `-- name: GetPostsForUserByPublished :many
+SELECT posts.id, posts.title, posts.url, posts.description, posts.published_at, posts.created_at,
+feeds.name as feed_name, post_reads.read_at, posts.author, posts.image_url,
+EXISTS (
+	SELECT 1 FROM filter_matches
+	INNER JOIN filter_rules
+	ON filter_matches.rule_id = filter_rules.id
+	WHERE filter_matches.post_id = posts.id
+	AND filter_rules.user_id = feed_follows.user_id
+	AND filter_rules.action = 'highlight'
+) AS highlighted,
+ARRAY(
+	SELECT post_categories.category
+	FROM post_categories
+	WHERE post_categories.post_id = posts.id
+	ORDER BY post_categories.category
+)::text[] as categories
+FROM posts
 INNER JOIN feed_follows
 ON posts.feed_id = feed_follows.feed_id
 INNER JOIN feeds
 ON posts.feed_id = feeds.id
+LEFT JOIN post_reads
+ON posts.id = post_reads.post_id
+AND post_reads.user_id = feed_follows.user_id
 WHERE feed_follows.user_id = $1
-ORDER BY posts.updated_at ASC
-LIMIT $2
+AND ($2::bool OR post_reads.read_at IS NULL)
+AND ($3::bool OR NOT EXISTS (
+	SELECT 1 FROM filter_matches
+	INNER JOIN filter_rules
+	ON filter_matches.rule_id = filter_rules.id
+	WHERE filter_matches.post_id = posts.id
+	AND filter_rules.user_id = feed_follows.user_id
+	AND filter_rules.action = 'hide'
+))
+AND ($4::uuid IS NULL OR posts.feed_id = $4)
+AND ($5::text IS NULL OR EXISTS (
+	SELECT 1 FROM feed_follow_tags
+	WHERE feed_follow_tags.feed_follow_id = feed_follows.id
+	AND feed_follow_tags.tag = $5
+))
+AND ($6::text IS NULL OR posts.author ILIKE '%' || $6 || '%')
+AND ($7::text IS NULL OR EXISTS (
+	SELECT 1 FROM post_categories
+	WHERE post_categories.post_id = posts.id
+	AND lower(post_categories.category) = lower($7)
+))
+AND (NOT $8::bool OR EXISTS (
+	SELECT 1 FROM post_enclosures
+	WHERE post_enclosures.post_id = posts.id
+))
+AND ($9::timestamp IS NULL OR posts.published_at >= $9)
+AND ($10::timestamp IS NULL OR posts.published_at < $10)
+AND ($11::timestamp IS NULL OR CASE WHEN $12::bool
+	THEN (posts.published_at, posts.id) < ($11, $13::uuid)
+	ELSE (posts.published_at, posts.id) > ($11, $13::uuid)
+END)
+ORDER BY
+CASE WHEN $12::bool THEN posts.published_at END DESC,
+CASE WHEN $12::bool THEN posts.id END DESC,
+posts.published_at ASC,
+posts.id ASC
+LIMIT $14
 `
 
-type GetPostsForUserParams struct {
-	UserID uuid.UUID
-	Limit  int32
+type GetPostsForUserByPublishedParams struct {
+	UserID        uuid.UUID
+	IncludeRead   bool
+	IncludeHidden bool
+	FeedID        uuid.NullUUID
+	Tag           sql.NullString
+	Author        sql.NullString
+	Category      sql.NullString
+	MediaOnly     bool
+	Since         sql.NullTime
+	Until         sql.NullTime
+	CursorKey     sql.NullTime
+	Descending    bool
+	CursorID      uuid.NullUUID
+	Limit         int32
 }
 
-type GetPostsForUserRow struct {
+type GetPostsForUserByPublishedRow struct {
+	ID          uuid.UUID
 	Title       sql.NullString
 	Url         string
 	Description sql.NullString
 	PublishedAt sql.NullTime
+	CreatedAt   time.Time
 	FeedName    string
+	ReadAt      sql.NullTime
+	Author      sql.NullString
+	ImageUrl    sql.NullString
+	Highlighted bool
+	Categories  []string
 }
 
-func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams) ([]GetPostsForUserRow, error) {
-	rows, err := q.db.QueryContext(ctx, getPostsForUser, arg.UserID, arg.Limit)
+// pages are walked with a keyset on (published_at, id), the cursor is the
+// last row of the previous page. the sort column is a real column rather than
+// a computed one so the keyset can use posts_feed_id_published_at_id_idx, and
+// the descending cases fold away since postgres plans with the parameters
+func (q *Queries) GetPostsForUserByPublished(ctx context.Context, arg GetPostsForUserByPublishedParams) ([]GetPostsForUserByPublishedRow, error) {
+	rows, err := q.db.QueryContext(ctx, getPostsForUserByPublished,
+		arg.UserID,
+		arg.IncludeRead,
+		arg.IncludeHidden,
+		arg.FeedID,
+		arg.Tag,
+		arg.Author,
+		arg.Category,
+		arg.MediaOnly,
+		arg.Since,
+		arg.Until,
+		arg.CursorKey,
+		arg.Descending,
+		arg.CursorID,
+		arg.Limit,
+	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []GetPostsForUserRow
+	var items []GetPostsForUserByPublishedRow
 	for rows.Next() {
-		var i GetPostsForUserRow
+		var i GetPostsForUserByPublishedRow
 		if err := rows.Scan(
+			&i.ID,
 			&i.Title,
 			&i.Url,
 			&i.Description,
 			&i.PublishedAt,
+			&i.CreatedAt,
 			&i.FeedName,
+			&i.ReadAt,
+			&i.Author,
+			&i.ImageUrl,
+			&i.Highlighted,
+			pq.Array(&i.Categories),
 		); err != nil {
 			return nil, err
 		}
@@ -116,3 +568,169 @@ func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams
 	}
 	return items, nil
 }
+
+const searchPosts = `-- name: SearchPosts :many
+SELECT posts.id, posts.title, posts.url, posts.published_at, feeds.name as feed_name, posts.author,
+ts_rank(posts.search, tsq)::real AS rank,
+ts_headline('english', coalesce(posts.description, posts.title, ''), tsq,
+	'StartSel=**, StopSel=**, MaxFragments=2, MaxWords=25, MinWords=10')::text AS snippet
+FROM posts
+INNER JOIN feeds
+ON posts.feed_id = feeds.id,
+websearch_to_tsquery('english', $1) tsq
+WHERE posts.search @@ tsq
+AND ($2::text IS NULL OR feeds.url = $2)
+AND ($3::timestamp IS NULL OR posts.published_at >= $3)
+AND ($4::timestamp IS NULL OR posts.published_at < $4)
+AND ($5::text IS NULL OR posts.author ILIKE '%' || $5 || '%')
+AND ($6::text IS NULL OR EXISTS (
+	SELECT 1 FROM post_categories
+	WHERE post_categories.post_id = posts.id
+	AND lower(post_categories.category) = lower($6)
+))
+AND (NOT $7::bool OR EXISTS (
+	SELECT 1 FROM feed_follows
+	WHERE feed_follows.feed_id = posts.feed_id
+	AND feed_follows.user_id = $8
+))
+AND ($9::bool OR NOT EXISTS (
+	SELECT 1 FROM filter_matches
+	INNER JOIN filter_rules
+	ON filter_matches.rule_id = filter_rules.id
+	WHERE filter_matches.post_id = posts.id
+	AND filter_rules.user_id = $8
+	AND filter_rules.action = 'hide'
+))
+ORDER BY rank DESC, posts.published_at DESC NULLS LAST
+LIMIT $10
+`
+
+type SearchPostsParams struct {
+	Query         string
+	FeedUrl       sql.NullString
+	Since         sql.NullTime
+	Until         sql.NullTime
+	Author        sql.NullString
+	Category      sql.NullString
+	FollowedOnly  bool
+	UserID        uuid.UUID
+	IncludeHidden bool
+	Limit         int32
+}
+
+type SearchPostsRow struct {
+	ID          uuid.UUID
+	Title       sql.NullString
+	Url         string
+	PublishedAt sql.NullTime
+	FeedName    string
+	Author      sql.NullString
+	Rank        float32
+	Snippet     string
+}
+
+func (q *Queries) SearchPosts(ctx context.Context, arg SearchPostsParams) ([]SearchPostsRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchPosts,
+		arg.Query,
+		arg.FeedUrl,
+		arg.Since,
+		arg.Until,
+		arg.Author,
+		arg.Category,
+		arg.FollowedOnly,
+		arg.UserID,
+		arg.IncludeHidden,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchPostsRow
+	for rows.Next() {
+		var i SearchPostsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Title,
+			&i.Url,
+			&i.PublishedAt,
+			&i.FeedName,
+			&i.Author,
+			&i.Rank,
+			&i.Snippet,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updatePost = `-- name: UpdatePost :one
+WITH revision AS (
+	INSERT INTO post_revisions (id, post_id, created_at, replaced_at, title, url, description, content, content_hash)
+	SELECT $12, posts.id, posts.updated_at, $1, posts.title, posts.url,
+	posts.description, posts.content, posts.content_hash
+	FROM posts
+	WHERE posts.feed_id = $10
+	AND posts.item_key = $11
+	AND (posts.content_hash IS DISTINCT FROM $9 OR posts.url <> $3)
+)
+UPDATE posts
+SET updated_at = $1,
+title = $2,
+url = $3,
+description = $4,
+content = $5,
+author = $6,
+comments_url = $7,
+image_url = $8,
+content_hash = $9
+WHERE posts.feed_id = $10
+AND posts.item_key = $11
+AND (posts.content_hash IS DISTINCT FROM $9 OR posts.url <> $3)
+RETURNING posts.id
+`
+
+type UpdatePostParams struct {
+	UpdatedAt   time.Time
+	Title       sql.NullString
+	Url         string
+	Description sql.NullString
+	Content     sql.NullString
+	Author      sql.NullString
+	CommentsUrl sql.NullString
+	ImageUrl    sql.NullString
+	ContentHash sql.NullString
+	FeedID      uuid.UUID
+	ItemKey     string
+	RevisionID  uuid.UUID
+}
+
+// records the stored version in post_revisions then overwrites it, nothing
+// happens and no row is returned if the content and link are unchanged
+func (q *Queries) UpdatePost(ctx context.Context, arg UpdatePostParams) (uuid.UUID, error) {
+	row := q.db.QueryRowContext(ctx, updatePost,
+		arg.UpdatedAt,
+		arg.Title,
+		arg.Url,
+		arg.Description,
+		arg.Content,
+		arg.Author,
+		arg.CommentsUrl,
+		arg.ImageUrl,
+		arg.ContentHash,
+		arg.FeedID,
+		arg.ItemKey,
+		arg.RevisionID,
+	)
+	var id uuid.UUID
+	err := row.Scan(&id)
+	return id, err
+}
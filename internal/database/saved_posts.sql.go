@@ -0,0 +1,121 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.28.0
+// source: saved_posts.sql
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const deleteSavedPost = `-- name: DeleteSavedPost :one
+DELETE FROM saved_posts
+WHERE user_id = $1
+AND (post_id = $2 OR url = $3)
+RETURNING id, created_at, user_id, post_id, title, url, description, published_at, feed_name
+`
+
+type DeleteSavedPostParams struct {
+	UserID uuid.UUID
+	PostID uuid.NullUUID
+	Url    string
+}
+
+func (q *Queries) DeleteSavedPost(ctx context.Context, arg DeleteSavedPostParams) (SavedPost, error) {
+	row := q.db.QueryRowContext(ctx, deleteSavedPost, arg.UserID, arg.PostID, arg.Url)
+	var i SavedPost
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UserID,
+		&i.PostID,
+		&i.Title,
+		&i.Url,
+		&i.Description,
+		&i.PublishedAt,
+		&i.FeedName,
+	)
+	return i, err
+}
+
+const getSavedPostsForUser = `-- name: GetSavedPostsForUser :many
+SELECT id, created_at, user_id, post_id, title, url, description, published_at, feed_name FROM saved_posts
+WHERE user_id = $1
+ORDER BY created_at DESC
+`
+
+func (q *Queries) GetSavedPostsForUser(ctx context.Context, userID uuid.UUID) ([]SavedPost, error) {
+	rows, err := q.db.QueryContext(ctx, getSavedPostsForUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SavedPost
+	for rows.Next() {
+		var i SavedPost
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UserID,
+			&i.PostID,
+			&i.Title,
+			&i.Url,
+			&i.Description,
+			&i.PublishedAt,
+			&i.FeedName,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const savePost = `-- name: SavePost :one
+INSERT INTO saved_posts (id, created_at, user_id, post_id, title, url, description, published_at, feed_name)
+SELECT $1, $2, $3, posts.id, posts.title, posts.url, posts.description, posts.published_at, feeds.name
+FROM posts
+INNER JOIN feeds
+ON posts.feed_id = feeds.id
+WHERE posts.id = $4
+RETURNING id, created_at, user_id, post_id, title, url, description, published_at, feed_name
+`
+
+type SavePostParams struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	PostID    uuid.UUID
+}
+
+func (q *Queries) SavePost(ctx context.Context, arg SavePostParams) (SavedPost, error) {
+	row := q.db.QueryRowContext(ctx, savePost,
+		arg.ID,
+		arg.CreatedAt,
+		arg.UserID,
+		arg.PostID,
+	)
+	var i SavedPost
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UserID,
+		&i.PostID,
+		&i.Title,
+		&i.Url,
+		&i.Description,
+		&i.PublishedAt,
+		&i.FeedName,
+	)
+	return i, err
+}
@@ -0,0 +1,365 @@
+// Package migrate applies the goose annotated migrations in sql/schema. It
+// keeps track of applied versions in goose's own goose_db_version table, so a
+// database that was set up with the goose cli carries on from where it was
+// and goose can still be used against a database migrated by the binary.
+//
+// Each file is named NNN_description.sql where NNN is its version, the
+// statements after "-- +goose Up" are applied and the ones after
+// "-- +goose Down" undo them. A section is sent to postgres in one piece so
+// function bodies and "-- +goose StatementBegin" blocks need no special
+// handling, and it runs in a transaction along with the version bookkeeping
+// unless the file has a "-- +goose NO TRANSACTION" line.
+package migrate
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// versionTable is goose's table name, rows are only ever inserted for applied
+// versions and deleted when they're rolled back, the same as goose does
+const versionTable = "goose_db_version"
+
+// lockID is held while migrating so two binaries started at once don't both
+// try to apply the same migration
+const lockID = 0x72616467 // "radg"
+
+var (
+	ErrNoMigrations = errors.New("no migrations have been applied")
+	ErrOutOfOrder   = errors.New("migration is out of order")
+)
+
+type Migration struct {
+	Version       int64
+	Name          string
+	Up            string
+	Down          string
+	NoTransaction bool
+}
+
+// Status is a migration and when it was applied, AppliedAt is the zero time
+// for pending migrations
+type Status struct {
+	Migration
+	AppliedAt time.Time
+}
+
+func (s Status) Applied() bool {
+	return !s.AppliedAt.IsZero()
+}
+
+// Load reads every .sql file in dir, sorted by version
+func Load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []Migration
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".sql" {
+			continue
+		}
+		prefix, _, _ := strings.Cut(entry.Name(), "_")
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("migration %s: name must start with a version number", entry.Name())
+		}
+		data, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migration, err := parse(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %w", entry.Name(), err)
+		}
+		migration.Version = version
+		migration.Name = entry.Name()
+		migrations = append(migrations, migration)
+	}
+
+	slices.SortFunc(migrations, func(a, b Migration) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return nil, fmt.Errorf("migrations %s and %s have the same version", migrations[i-1].Name, migrations[i].Name)
+		}
+	}
+	return migrations, nil
+}
+
+// parse splits a file into its up and down sections, anything before the
+// first annotation is ignored
+func parse(data string) (Migration, error) {
+	var migration Migration
+	var up, down strings.Builder
+	var section *strings.Builder
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		annotation, ok := strings.CutPrefix(strings.TrimSpace(line), "-- +goose ")
+		if ok {
+			switch strings.ToUpper(strings.TrimSpace(annotation)) {
+			case "UP":
+				section = &up
+				continue
+			case "DOWN":
+				section = &down
+				continue
+			case "NO TRANSACTION":
+				migration.NoTransaction = true
+				continue
+			}
+		}
+		if section != nil {
+			section.WriteString(line)
+			section.WriteByte('\n')
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return migration, err
+	}
+	if strings.TrimSpace(up.String()) == "" {
+		return migration, errors.New("missing -- +goose Up section")
+	}
+	migration.Up = up.String()
+	migration.Down = down.String()
+	return migration, nil
+}
+
+// ensureTable creates the version table the way goose does, including the
+// version 0 row goose expects to find
+func ensureTable(ctx context.Context, db *sql.DB) error {
+	var exists bool
+	err := db.QueryRowContext(ctx, "SELECT to_regclass($1) IS NOT NULL", versionTable).Scan(&exists)
+	if err != nil || exists {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+versionTable+` (
+		id serial NOT NULL,
+		version_id bigint NOT NULL,
+		is_applied boolean NOT NULL,
+		tstamp timestamp NULL DEFAULT now(),
+		PRIMARY KEY (id)
+	)`)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "INSERT INTO "+versionTable+" (version_id, is_applied) VALUES (0, true)")
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// applied maps each applied version to when it was applied, goose leaves
+// rows for rolled back versions in older databases so only the latest row
+// for a version counts
+func applied(ctx context.Context, db *sql.DB) (map[int64]time.Time, error) {
+	var exists bool
+	err := db.QueryRowContext(ctx, "SELECT to_regclass($1) IS NOT NULL", versionTable).Scan(&exists)
+	if err != nil || !exists {
+		return map[int64]time.Time{}, err
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT version_id, is_applied, tstamp FROM "+versionTable+" ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	versions := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var isApplied bool
+		var tstamp sql.NullTime
+		if err := rows.Scan(&version, &isApplied, &tstamp); err != nil {
+			return nil, err
+		}
+		if version == 0 {
+			continue
+		}
+		if !isApplied {
+			delete(versions, version)
+			continue
+		}
+		if !tstamp.Valid {
+			// still counts as applied, it just has no time to show
+			tstamp.Time = time.Unix(0, 0)
+		}
+		versions[version] = tstamp.Time
+	}
+	return versions, rows.Err()
+}
+
+// Statuses reports whether each migration has been applied
+func Statuses(ctx context.Context, db *sql.DB, migrations []Migration) ([]Status, error) {
+	versions, err := applied(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]Status, 0, len(migrations))
+	for _, migration := range migrations {
+		statuses = append(statuses, Status{
+			Migration: migration,
+			AppliedAt: versions[migration.Version],
+		})
+	}
+	return statuses, nil
+}
+
+// Pending lists the migrations that haven't been applied yet, in the order
+// they'll be applied. Like goose it refuses to apply a migration older than
+// the latest applied one, that usually means two branches each added one and
+// it has to be renumbered or applied by hand
+func Pending(ctx context.Context, db *sql.DB, migrations []Migration) ([]Migration, error) {
+	versions, err := applied(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	return pending(migrations, versions)
+}
+
+func pending(migrations []Migration, versions map[int64]time.Time) ([]Migration, error) {
+	var latest int64
+	for version := range versions {
+		latest = max(latest, version)
+	}
+	var pending []Migration
+	for _, migration := range migrations {
+		if _, ok := versions[migration.Version]; ok {
+			continue
+		}
+		if migration.Version < latest {
+			return nil, fmt.Errorf("%w: %s is older than the latest applied version %d", ErrOutOfOrder, migration.Name, latest)
+		}
+		pending = append(pending, migration)
+	}
+	return pending, nil
+}
+
+// Up applies every pending migration in order and returns the ones it
+// applied, it stops at the first one that fails
+func Up(ctx context.Context, db *sql.DB, migrations []Migration) ([]Migration, error) {
+	unlock, err := lock(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if err := ensureTable(ctx, db); err != nil {
+		return nil, err
+	}
+
+	pending, err := Pending(ctx, db, migrations)
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	for _, migration := range pending {
+		err := run(ctx, db, migration.Up, migration.NoTransaction,
+			"INSERT INTO "+versionTable+" (version_id, is_applied) VALUES ($1, true)", migration.Version)
+		if err != nil {
+			return done, fmt.Errorf("migration %s: %w", migration.Name, err)
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// Down rolls back the most recently applied migration and returns it
+func Down(ctx context.Context, db *sql.DB, migrations []Migration) (Migration, error) {
+	unlock, err := lock(ctx, db)
+	if err != nil {
+		return Migration{}, err
+	}
+	defer unlock()
+
+	versions, err := applied(ctx, db)
+	if err != nil {
+		return Migration{}, err
+	}
+	var latest int64
+	for version := range versions {
+		latest = max(latest, version)
+	}
+	if latest == 0 {
+		return Migration{}, ErrNoMigrations
+	}
+	i := slices.IndexFunc(migrations, func(m Migration) bool {
+		return m.Version == latest
+	})
+	if i < 0 {
+		return Migration{}, fmt.Errorf("version %d is applied but there's no migration for it", latest)
+	}
+
+	migration := migrations[i]
+	err = run(ctx, db, migration.Down, migration.NoTransaction,
+		"DELETE FROM "+versionTable+" WHERE version_id = $1", migration.Version)
+	if err != nil {
+		return migration, fmt.Errorf("migration %s: %w", migration.Name, err)
+	}
+	return migration, nil
+}
+
+// run executes a migration section and records the change to the version
+// table, both in one transaction when the migration allows it
+func run(ctx context.Context, db *sql.DB, statements string, noTransaction bool, record string, version int64) error {
+	if noTransaction {
+		if strings.TrimSpace(statements) != "" {
+			if _, err := db.ExecContext(ctx, statements); err != nil {
+				return err
+			}
+		}
+		_, err := db.ExecContext(ctx, record, version)
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if strings.TrimSpace(statements) != "" {
+		if _, err := tx.ExecContext(ctx, statements); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, record, version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// lock takes a session level advisory lock on a connection of its own, the
+// returned func releases it
+func lock(ctx context.Context, db *sql.DB) (func(), error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockID); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return func() {
+		conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockID)
+		conn.Close()
+	}, nil
+}
@@ -0,0 +1,191 @@
+package migrate
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	migration, err := parse(`-- a comment before any annotation is dropped
+-- +goose Up
+CREATE TABLE users (id UUID PRIMARY KEY);
+
+-- +goose StatementBegin
+CREATE FUNCTION touch() RETURNS trigger AS $$
+BEGIN
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose Down
+DROP FUNCTION touch;
+DROP TABLE users;
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(migration.Up, "comment before") {
+		t.Errorf("up section includes the text before the annotation:\n%s", migration.Up)
+	}
+	for _, want := range []string{"CREATE TABLE users", "CREATE FUNCTION touch()", "RETURN NEW;", "$$ LANGUAGE plpgsql;"} {
+		if !strings.Contains(migration.Up, want) {
+			t.Errorf("up section is missing %q:\n%s", want, migration.Up)
+		}
+	}
+	if strings.Contains(migration.Up, "DROP") {
+		t.Errorf("up section includes the down section:\n%s", migration.Up)
+	}
+	if want := "DROP FUNCTION touch;\nDROP TABLE users;\n"; migration.Down != want {
+		t.Errorf("down section = %q, want %q", migration.Down, want)
+	}
+	if migration.NoTransaction {
+		t.Error("NoTransaction set without the annotation")
+	}
+}
+
+func TestParseNoTransaction(t *testing.T) {
+	migration, err := parse(`-- +goose NO TRANSACTION
+-- +goose Up
+CREATE INDEX CONCURRENTLY posts_url_idx ON posts (url);
+
+-- +goose Down
+DROP INDEX CONCURRENTLY posts_url_idx;
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !migration.NoTransaction {
+		t.Error("NoTransaction not set")
+	}
+	if strings.Contains(migration.Up, "NO TRANSACTION") {
+		t.Errorf("annotation left in the up section:\n%s", migration.Up)
+	}
+}
+
+func TestParseMissingUp(t *testing.T) {
+	for _, data := range []string{
+		"",
+		"CREATE TABLE users (id UUID);\n",
+		"-- +goose Down\nDROP TABLE users;\n",
+		"-- +goose Up\n\n-- +goose Down\nDROP TABLE users;\n",
+	} {
+		if _, err := parse(data); err == nil {
+			t.Errorf("parse(%q) succeeded, want an error", data)
+		}
+	}
+}
+
+const simple = "-- +goose Up\nSELECT 1;\n-- +goose Down\nSELECT 2;\n"
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"schema/010_saved_posts.sql": {Data: []byte(simple)},
+		"schema/002_feeds.sql":       {Data: []byte(simple)},
+		"schema/001_users.sql":       {Data: []byte(simple)},
+		"schema/README.md":           {Data: []byte("not a migration")},
+		"schema/old/003_skipped.sql": {Data: []byte(simple)},
+	}
+	migrations, err := Load(fsys, "schema")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		version int64
+		name    string
+	}{
+		{1, "001_users.sql"},
+		{2, "002_feeds.sql"},
+		{10, "010_saved_posts.sql"},
+	}
+	if len(migrations) != len(want) {
+		t.Fatalf("loaded %d migrations, want %d", len(migrations), len(want))
+	}
+	for i, w := range want {
+		if migrations[i].Version != w.version || migrations[i].Name != w.name {
+			t.Errorf("migration %d = %d %s, want %d %s", i, migrations[i].Version, migrations[i].Name, w.version, w.name)
+		}
+		if migrations[i].Up != "SELECT 1;\n" || migrations[i].Down != "SELECT 2;\n" {
+			t.Errorf("migration %s has up %q and down %q", w.name, migrations[i].Up, migrations[i].Down)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := map[string]fstest.MapFS{
+		"no version": {
+			"schema/users.sql": {Data: []byte(simple)},
+		},
+		"version zero": {
+			"schema/000_users.sql": {Data: []byte(simple)},
+		},
+		"duplicate version": {
+			"schema/001_users.sql": {Data: []byte(simple)},
+			"schema/01_feeds.sql":  {Data: []byte(simple)},
+		},
+		"missing up": {
+			"schema/001_users.sql": {Data: []byte("-- +goose Down\nSELECT 2;\n")},
+		},
+		"missing directory": {},
+	}
+	for name, fsys := range tests {
+		if _, err := Load(fsys, "schema"); err == nil {
+			t.Errorf("%s: Load succeeded, want an error", name)
+		}
+	}
+}
+
+func TestPending(t *testing.T) {
+	migrations := []Migration{
+		{Version: 1, Name: "001_users.sql"},
+		{Version: 2, Name: "002_feeds.sql"},
+		{Version: 3, Name: "003_posts.sql"},
+	}
+	applied := func(versions ...int64) map[int64]time.Time {
+		m := make(map[int64]time.Time)
+		for _, version := range versions {
+			m[version] = time.Now()
+		}
+		return m
+	}
+
+	tests := []struct {
+		name    string
+		applied map[int64]time.Time
+		want    []int64
+	}{
+		{"fresh database", applied(), []int64{1, 2, 3}},
+		{"part way", applied(1), []int64{2, 3}},
+		{"up to date", applied(1, 2, 3), nil},
+		{"applied version without a file", applied(1, 2, 3, 4), nil},
+	}
+	for _, tt := range tests {
+		got, err := pending(migrations, tt.applied)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		var versions []int64
+		for _, migration := range got {
+			versions = append(versions, migration.Version)
+		}
+		if len(versions) != len(tt.want) {
+			t.Errorf("%s: pending = %v, want %v", tt.name, versions, tt.want)
+			continue
+		}
+		for i := range versions {
+			if versions[i] != tt.want[i] {
+				t.Errorf("%s: pending = %v, want %v", tt.name, versions, tt.want)
+				break
+			}
+		}
+	}
+
+	if _, err := pending(migrations, applied(1, 3)); !errors.Is(err, ErrOutOfOrder) {
+		t.Errorf("gap below the latest applied version: got %v, want ErrOutOfOrder", err)
+	}
+}
@@ -0,0 +1,273 @@
+// Package pubdate parses the publication dates found in real world feeds,
+// which only loosely follow the rfc822 and rfc3339 layouts they're meant to.
+// Dates like "Tue, 3 Sep 2024 9:05 PDT", "2024-09-03 21:05:00", "Tuesday,
+// 03-Sep-24 21:05:00 GMT+2" and "Sept 3rd, 2024 9:05:00 +0200 (CEST)" are all
+// understood, named zones are resolved with a table of abbreviations rather
+// than being silently treated as UTC like time.Parse does.
+package pubdate
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Source records which heuristic produced a date so bad guesses can be
+// traced back later
+type Source string
+
+const (
+	// SourceStandard dates matched a standard layout as is
+	SourceStandard Source = "standard"
+	// SourceLenient dates needed cleaning up or a non standard layout
+	SourceLenient Source = "lenient"
+	// SourceZoneAbbreviation dates had a named zone looked up in zoneOffsets
+	SourceZoneAbbreviation Source = "zone-abbreviation"
+	// SourceNoZone dates had no zone at all and are assumed to be UTC
+	SourceNoZone Source = "no-zone"
+	// SourceFeed dates are the feed's own build or publish date
+	SourceFeed Source = "feed"
+	// SourceFetched dates are the time the feed was fetched
+	SourceFetched Source = "fetched"
+)
+
+var ErrUnparseable = errors.New("unparseable date")
+
+// standardLayouts are tried before anything else, only layouts with numeric
+// offsets are listed since time.Parse makes up a zero offset for named zones
+// it doesn't know
+var standardLayouts = []string{
+	time.RFC1123Z,
+	time.RFC3339,
+	time.RFC3339Nano,
+	time.RFC822Z,
+}
+
+var isoLayouts = []string{
+	"2006-01-02T15:04:05Z07:00",
+	"2006-01-02T15:04:05-0700",
+	"2006-01-02T15:04:05-07",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04-0700",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05 Z07:00",
+	"2006-01-02 15:04:05-0700",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04 -0700",
+}
+
+var isoLayoutsNoZone = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006/01/02 15:04:05",
+	"2006/01/02 15:04",
+	"2006/01/02",
+}
+
+// textLayouts are matched against dates that have had their weekday and
+// commas removed and their zone normalised to a numeric offset
+var textLayouts = []string{
+	"2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04 -0700",
+	"2 Jan 06 15:04:05 -0700",
+	"2 Jan 06 15:04 -0700",
+	"2 January 2006 15:04:05 -0700",
+	"2 January 2006 15:04 -0700",
+	"2-Jan-06 15:04:05 -0700",
+	"2-Jan-2006 15:04:05 -0700",
+	"Jan 2 2006 15:04:05 -0700",
+	"Jan 2 2006 15:04 -0700",
+	"Jan 2 2006 3:04:05 PM -0700",
+	"Jan 2 2006 3:04 PM -0700",
+	"January 2 2006 15:04:05 -0700",
+	"January 2 2006 15:04 -0700",
+	"January 2 2006 3:04:05 PM -0700",
+	"January 2 2006 3:04 PM -0700",
+	"Jan 2 15:04:05 2006 -0700",
+	"2 Jan 2006 -0700",
+	"2 January 2006 -0700",
+	"Jan 2 2006 -0700",
+	"January 2 2006 -0700",
+}
+
+// zoneOffsets maps the zone abbreviations seen in feeds to their offset from
+// UTC in minutes. Some abbreviations are ambiguous, IST is India rather than
+// Ireland or Israel and BST is British Summer Time, those being by far the
+// most common in feeds
+var zoneOffsets = map[string]int{
+	"UT": 0, "UTC": 0, "GMT": 0, "Z": 0, "WET": 0, "WEST": 60,
+	"BST": 60, "IST": 330, "CET": 60, "CEST": 120, "MET": 60, "MEST": 120,
+	"EET": 120, "EEST": 180, "MSK": 180, "TRT": 180, "IDT": 180,
+	"SAST": 120, "WAT": 60, "CAT": 120, "EAT": 180,
+	"IRST": 210, "GST": 240, "PKT": 300, "NPT": 345, "ICT": 420, "WIB": 420,
+	"HKT": 480, "SGT": 480, "PHT": 480, "AWST": 480, "CST": -360, "JST": 540,
+	"KST": 540, "ACST": 570, "ACDT": 630, "AEST": 600, "AEDT": 660,
+	"NZST": 720, "NZDT": 780,
+	"EST": -300, "EDT": -240, "CDT": -300, "MST": -420, "MDT": -360,
+	"PST": -480, "PDT": -420, "AKST": -540, "AKDT": -480, "HST": -600,
+	"AST": -240, "ADT": -180, "NST": -210, "NDT": -150,
+	"BRT": -180, "ART": -180, "CLT": -240, "CLST": -180,
+}
+
+var (
+	whitespaceRegex  = regexp.MustCompile(`\s+`)
+	commentRegex     = regexp.MustCompile(`\s*\([^)]*\)$`)
+	weekdayRegex     = regexp.MustCompile(`(?i)^(mon|tue|tues|wed|thu|thur|thurs|fri|sat|sun)(day|nesday|sday|urday)?\.?,?\s+`)
+	ordinalRegex     = regexp.MustCompile(`(?i)\b(\d{1,2})(st|nd|rd|th)\b`)
+	isoRegex         = regexp.MustCompile(`^\d{4}[-/]\d{2}[-/]\d{2}`)
+	offsetRegex      = regexp.MustCompile(`^([+-])(\d{1,2}):?(\d{2})?$`)
+	prefixedRegex    = regexp.MustCompile(`(?i)^(GMT|UTC|UT)([+-]\d{1,2}(?::?\d{2})?)$`)
+	unknownZoneRegex = regexp.MustCompile(`^[A-Z]{2,5}$`)
+	meridiemRegex    = regexp.MustCompile(`(?i)\s*([ap])\.?m\.?$`)
+)
+
+// Parse parses a feed date, returning the time and the heuristic that was
+// needed to get it
+func Parse(value string) (time.Time, Source, error) {
+	value = strings.TrimSpace(whitespaceRegex.ReplaceAllString(value, " "))
+	if value == "" {
+		return time.Time{}, "", ErrUnparseable
+	}
+
+	for _, layout := range standardLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, SourceStandard, nil
+		}
+	}
+
+	value = commentRegex.ReplaceAllString(value, "")
+	if isoRegex.MatchString(value) {
+		return parseISO(value)
+	}
+	return parseText(value)
+}
+
+// ParseWithFallback parses value and falls back to the feed's own date and
+// then the fetch time when it can't be parsed, so a post always has a date
+func ParseWithFallback(value, feedDate string, fetchedAt time.Time) (time.Time, Source) {
+	if t, source, err := Parse(value); err == nil {
+		return t, source
+	}
+	if t, _, err := Parse(feedDate); err == nil {
+		return t, SourceFeed
+	}
+	return fetchedAt, SourceFetched
+}
+
+func parseISO(value string) (time.Time, Source, error) {
+	source := SourceLenient
+	// a trailing named zone, "2024-09-03 21:05:00 PDT"
+	if fields := strings.Fields(value); len(fields) > 2 {
+		if minutes, ok := zoneOffsets[strings.ToUpper(fields[len(fields)-1])]; ok {
+			value = strings.Join(fields[:len(fields)-1], " ") + " " + formatOffset(minutes)
+			if minutes != 0 {
+				source = SourceZoneAbbreviation
+			}
+		}
+	}
+
+	for _, layout := range isoLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, source, nil
+		}
+	}
+	for _, layout := range isoLayoutsNoZone {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, SourceNoZone, nil
+		}
+	}
+	return time.Time{}, "", fmt.Errorf("%w: %q", ErrUnparseable, value)
+}
+
+func parseText(original string) (time.Time, Source, error) {
+	value := weekdayRegex.ReplaceAllString(original, "")
+	value = strings.ReplaceAll(value, ",", " ")
+	value = strings.ReplaceAll(value, " at ", " ")
+	value = ordinalRegex.ReplaceAllString(value, "$1")
+	value = strings.Replace(value, "Sept ", "Sep ", 1)
+	value = strings.TrimSpace(whitespaceRegex.ReplaceAllString(value, " "))
+
+	source := SourceLenient
+	fields := strings.Fields(value)
+	zone, zoneSource, ok := normaliseZone(fields)
+	if ok {
+		fields = fields[:len(fields)-1]
+		// "+0000 GMT" style dates carry the zone twice
+		if len(fields) > 0 && offsetRegex.MatchString(fields[len(fields)-1]) {
+			zone, _, _ = normaliseZone(fields)
+			fields = fields[:len(fields)-1]
+		} else if zoneSource != "" {
+			source = zoneSource
+		}
+	} else {
+		// an unknown named zone is dropped rather than failing the whole date
+		if n := len(fields); n > 1 && unknownZoneRegex.MatchString(fields[n-1]) && fields[n-1] != "AM" && fields[n-1] != "PM" {
+			fields = fields[:n-1]
+		}
+		zone = "+0000"
+		source = SourceNoZone
+	}
+	value = strings.Join(fields, " ")
+	value = meridiemRegex.ReplaceAllStringFunc(value, func(m string) string {
+		return " " + strings.ToUpper(strings.TrimSpace(m)[:1]) + "M"
+	})
+	value += " " + zone
+
+	for _, layout := range textLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, source, nil
+		}
+	}
+	return time.Time{}, "", fmt.Errorf("%w: %q", ErrUnparseable, original)
+}
+
+// normaliseZone turns the last field of a date into a numeric -0700 style
+// offset if it's a zone, the returned source is only set when the zone had
+// to be looked up by name
+func normaliseZone(fields []string) (string, Source, bool) {
+	if len(fields) == 0 {
+		return "", "", false
+	}
+	last := fields[len(fields)-1]
+
+	if match := offsetRegex.FindStringSubmatch(last); match != nil {
+		return offsetFromParts(match[1], match[2], match[3]), "", true
+	}
+	if match := prefixedRegex.FindStringSubmatch(last); match != nil {
+		offset := offsetRegex.FindStringSubmatch(match[2])
+		return offsetFromParts(offset[1], offset[2], offset[3]), "", true
+	}
+	upper := strings.ToUpper(last)
+	if minutes, ok := zoneOffsets[upper]; ok {
+		if minutes == 0 {
+			return formatOffset(0), "", true
+		}
+		return formatOffset(minutes), SourceZoneAbbreviation, true
+	}
+	return "", "", false
+}
+
+func offsetFromParts(sign, hours, minutes string) string {
+	h, _ := strconv.Atoi(hours)
+	m, _ := strconv.Atoi(minutes)
+	total := h*60 + m
+	if sign == "-" {
+		total = -total
+	}
+	return formatOffset(total)
+}
+
+func formatOffset(minutes int) string {
+	sign := "+"
+	if minutes < 0 {
+		sign = "-"
+		minutes = -minutes
+	}
+	return fmt.Sprintf("%s%02d%02d", sign, minutes/60, minutes%60)
+}
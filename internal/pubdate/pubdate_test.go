@@ -0,0 +1,127 @@
+package pubdate
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// 2024-09-03 16:05:00 UTC, most of the cases below are this instant written
+// the way some feed in the wild writes it
+var sept3 = time.Date(2024, time.September, 3, 16, 5, 0, 0, time.UTC)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		value  string
+		want   time.Time
+		source Source
+	}{
+		// standard layouts
+		{"Tue, 03 Sep 2024 16:05:00 +0000", sept3, SourceStandard},
+		{"Tue, 03 Sep 2024 09:05:00 -0700", sept3, SourceStandard},
+		{"2024-09-03T16:05:00Z", sept3, SourceStandard},
+		{"2024-09-03T18:05:00+02:00", sept3, SourceStandard},
+		{"2024-09-03T16:05:00.123Z", sept3.Add(123 * time.Millisecond), SourceStandard},
+		{"03 Sep 24 09:05 -0700", sept3, SourceStandard},
+
+		// zone abbreviations
+		{"Tue, 3 Sep 2024 9:05 PDT", sept3, SourceZoneAbbreviation},
+		{"Tue, 03 Sep 2024 09:05:00 PDT", sept3, SourceZoneAbbreviation},
+		{"Tue, 03 Sep 2024 12:05:00 EDT", sept3, SourceZoneAbbreviation},
+		{"Tue, 03 Sep 2024 11:05:00 CDT", sept3, SourceZoneAbbreviation},
+		{"Tue, 03 Sep 2024 18:05:00 CEST", sept3, SourceZoneAbbreviation},
+		{"Tue, 03 Sep 2024 17:05:00 BST", sept3, SourceZoneAbbreviation},
+		{"Tue, 03 Sep 2024 21:35:00 IST", sept3, SourceZoneAbbreviation},
+		{"Wed, 04 Sep 2024 02:05:00 AEST", sept3, SourceZoneAbbreviation},
+		{"Tue, 03 Sep 2024 16:05:00 GMT", sept3, SourceLenient},
+		{"Tue, 03 Sep 2024 16:05:00 UT", sept3, SourceLenient},
+		{"2024-09-03 09:05:00 PDT", sept3, SourceZoneAbbreviation},
+		{"Sept 3rd, 2024 18:05:00 +0200 (CEST)", sept3, SourceLenient},
+
+		// prefixed and duplicated zones
+		{"Tuesday, 03-Sep-24 18:05:00 GMT+2", sept3, SourceLenient},
+		{"Tue, 03 Sep 2024 16:05:00 +0000 GMT", sept3, SourceLenient},
+		{"Tue, 03 Sep 2024 18:05:00 UTC+02:00", sept3, SourceLenient},
+
+		// missing seconds
+		{"Tue, 03 Sep 2024 16:05 +0000", sept3, SourceLenient},
+		{"2024-09-03T09:05-07:00", sept3, SourceLenient},
+		{"2024-09-03 09:05 -0700", sept3, SourceLenient},
+		{"September 3, 2024 at 9:05 AM PDT", sept3, SourceZoneAbbreviation},
+
+		// text months and 12 hour clocks
+		{"Sep 3, 2024 9:05:00 am -0700", sept3, SourceLenient},
+		{"September 3rd 2024 4:05 p.m. GMT", sept3, SourceLenient},
+		{"3 September 2024 16:05:00 +0000", sept3, SourceLenient},
+		{"Tue Sep 3 16:05:00 2024 +0000", sept3, SourceLenient},
+
+		// no zone at all is taken to be UTC
+		{"2024-09-03 16:05:00", sept3, SourceNoZone},
+		{"2024-09-03T16:05", sept3, SourceNoZone},
+		{"2024/09/03 16:05:00", sept3, SourceNoZone},
+		{"Tue, 03 Sep 2024 16:05:00", sept3, SourceNoZone},
+		{"Tue, 03 Sep 2024 16:05:00 XYZT", sept3, SourceNoZone},
+		{"2024-09-03", time.Date(2024, time.September, 3, 0, 0, 0, 0, time.UTC), SourceNoZone},
+		{"3 September 2024", time.Date(2024, time.September, 3, 0, 0, 0, 0, time.UTC), SourceNoZone},
+
+		// whitespace
+		{"  Tue,  03 Sep 2024\n16:05:00 +0000 ", sept3, SourceStandard},
+	}
+
+	for _, tt := range tests {
+		got, source, err := Parse(tt.value)
+		if err != nil {
+			t.Errorf("Parse(%q) returned error: %v", tt.value, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("Parse(%q) = %s, want %s", tt.value, got.UTC(), tt.want)
+		}
+		if source != tt.source {
+			t.Errorf("Parse(%q) source = %q, want %q", tt.value, source, tt.source)
+		}
+	}
+}
+
+func TestParseUnparseable(t *testing.T) {
+	for _, value := range []string{
+		"",
+		"   ",
+		"yesterday",
+		"not a date",
+		"32 Sep 2024 16:05:00 +0000",
+		"2024-13-03",
+	} {
+		if got, _, err := Parse(value); !errors.Is(err, ErrUnparseable) {
+			t.Errorf("Parse(%q) = %s, %v, want ErrUnparseable", value, got, err)
+		}
+	}
+}
+
+func TestParseWithFallback(t *testing.T) {
+	fetchedAt := time.Date(2024, time.September, 4, 8, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		value    string
+		feedDate string
+		want     time.Time
+		source   Source
+	}{
+		{"item date", "Tue, 3 Sep 2024 9:05 PDT", "Wed, 04 Sep 2024 07:00:00 GMT", sept3, SourceZoneAbbreviation},
+		{"feed date", "soon", "Tue, 03 Sep 2024 16:05:00 +0000", sept3, SourceFeed},
+		{"missing item date", "", "2024-09-03T16:05:00Z", sept3, SourceFeed},
+		{"feed date with zone", "", "Tue, 03 Sep 2024 12:05:00 EDT", sept3, SourceFeed},
+		{"fetch time", "soon", "later", fetchedAt, SourceFetched},
+		{"nothing at all", "", "", fetchedAt, SourceFetched},
+	}
+
+	for _, tt := range tests {
+		got, source := ParseWithFallback(tt.value, tt.feedDate, fetchedAt)
+		if !got.Equal(tt.want) {
+			t.Errorf("%s: got %s, want %s", tt.name, got.UTC(), tt.want)
+		}
+		if source != tt.source {
+			t.Errorf("%s: source = %q, want %q", tt.name, source, tt.source)
+		}
+	}
+}
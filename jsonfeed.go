@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type JSONFeed struct {
+	Version     string           `json:"version"`
+	Title       string           `json:"title"`
+	HomePageURL string           `json:"home_page_url"`
+	Description string           `json:"description"`
+	Author      JSONFeedAuthor   `json:"author"`
+	Authors     []JSONFeedAuthor `json:"authors"`
+	Items       []JSONFeedItem   `json:"items"`
+}
+
+type JSONFeedItem struct {
+	ID            jsonFeedID `json:"id"`
+	URL           string     `json:"url"`
+	ExternalURL   string     `json:"external_url"`
+	Title         string     `json:"title"`
+	ContentText   string     `json:"content_text"`
+	ContentHTML   string     `json:"content_html"`
+	Summary       string     `json:"summary"`
+	DatePublished string     `json:"date_published"`
+	DateModified  string     `json:"date_modified"`
+	// author is from version 1.0, 1.1 replaced it with authors
+	Author  JSONFeedAuthor   `json:"author"`
+	Authors []JSONFeedAuthor `json:"authors"`
+	Tags    []string         `json:"tags"`
+	Image   string           `json:"image"`
+
+	Attachments []JSONFeedAttachment `json:"attachments"`
+}
+
+// jsonFeedID is an item's id, the spec says it's a string but plenty of
+// feeds write it as a number
+type jsonFeedID string
+
+func (id *jsonFeedID) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*id = ""
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*id = jsonFeedID(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("item id must be a string or a number, got %s", data)
+	}
+	*id = jsonFeedID(n)
+	return nil
+}
+
+type JSONFeedAttachment struct {
+	URL               string  `json:"url"`
+	MimeType          string  `json:"mime_type"`
+	SizeInBytes       int64   `json:"size_in_bytes"`
+	DurationInSeconds float64 `json:"duration_in_seconds"`
+}
+
+type JSONFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+func parseJSONFeed(feedData []byte) (*JSONFeed, error) {
+	var feed JSONFeed
+	if err := json.Unmarshal(feedData, &feed); err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(feed.Version, "https://jsonfeed.org/version/") {
+		return nil, fmt.Errorf("unsupported json feed version: %q", feed.Version)
+	}
+	return &feed, nil
+}
+
+func jsonFeedAuthors(author JSONFeedAuthor, authors []JSONFeedAuthor) string {
+	var names []string
+	for _, a := range append([]JSONFeedAuthor{author}, authors...) {
+		if name := strings.TrimSpace(a.Name); name != "" && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// toRSS normalises a json feed into the same shape as an rss feed, items
+// without a url fall back to external_url and then their id which the spec
+// recommends be a permalink anyway
+func (j *JSONFeed) toRSS() *RSSFeed {
+	var feed RSSFeed
+	feed.Channel.Title = j.Title
+	feed.Channel.Link = j.HomePageURL
+	feed.Channel.Description = j.Description
+
+	for _, item := range j.Items {
+		post := RSSItem{
+			Title:       item.Title,
+			Link:        item.URL,
+			Description: item.ContentText,
+			PubDate:     item.DatePublished,
+			Content:     item.ContentHTML,
+			Creator:     jsonFeedAuthors(item.Author, item.Authors),
+			Category:    item.Tags,
+			GUID: RSSGUID{
+				Value:       string(item.ID),
+				IsPermaLink: "false",
+			},
+		}
+		if post.Creator == "" {
+			post.Creator = jsonFeedAuthors(j.Author, j.Authors)
+		}
+		post.Image.Href = item.Image
+		for _, attachment := range item.Attachments {
+			post.MediaContent = append(post.MediaContent, MediaContent{
+				URL:      attachment.URL,
+				Type:     attachment.MimeType,
+				FileSize: strconv.FormatInt(attachment.SizeInBytes, 10),
+				Duration: strconv.FormatFloat(attachment.DurationInSeconds, 'f', -1, 64),
+			})
+		}
+		if post.Link == "" {
+			post.Link = item.ExternalURL
+		}
+		if post.Link == "" {
+			post.Link = string(item.ID)
+		}
+		if post.Description == "" {
+			post.Description = item.Summary
+		}
+		if post.Description == "" {
+			post.Description = item.ContentHTML
+		}
+		if post.PubDate == "" {
+			post.PubDate = item.DateModified
+		}
+		feed.Channel.Item = append(feed.Channel.Item, post)
+	}
+
+	return &feed
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+func TestJSONFeedID(t *testing.T) {
+	tests := []struct {
+		data string
+		want jsonFeedID
+	}{
+		{`"abc"`, "abc"},
+		{`"https://example.com/1"`, "https://example.com/1"},
+		{`""`, ""},
+		{`42`, "42"},
+		{`12345678901234567890`, "12345678901234567890"},
+		{`1.5`, "1.5"},
+		{`null`, ""},
+	}
+
+	for _, tt := range tests {
+		var id jsonFeedID
+		if err := json.Unmarshal([]byte(tt.data), &id); err != nil {
+			t.Errorf("unmarshal %s returned error: %v", tt.data, err)
+			continue
+		}
+		if id != tt.want {
+			t.Errorf("unmarshal %s = %q, want %q", tt.data, id, tt.want)
+		}
+	}
+
+	for _, data := range []string{`true`, `{}`, `["1"]`} {
+		var id jsonFeedID
+		if err := json.Unmarshal([]byte(data), &id); err == nil {
+			t.Errorf("unmarshal %s = %q, want an error", data, id)
+		}
+	}
+}
+
+const jsonFeed = `{
+	"version": "https://jsonfeed.org/version/1.1",
+	"title": "Example",
+	"home_page_url": "https://example.com/",
+	"description": "an example feed",
+	"authors": [{"name": "Feed Author"}],
+	"items": [
+		{
+			"id": 1,
+			"url": "https://example.com/first",
+			"title": "First",
+			"content_text": "the text",
+			"content_html": "<p>the html</p>",
+			"date_published": "2024-09-03T16:05:00Z",
+			"authors": [{"name": "Alice"}, {"name": "Bob"}, {"name": "Alice"}],
+			"tags": ["go", "feeds"],
+			"image": "https://example.com/first.png",
+			"attachments": [
+				{"url": "https://example.com/first.mp3", "mime_type": "audio/mpeg", "size_in_bytes": 1234, "duration_in_seconds": 61.5}
+			]
+		},
+		{
+			"id": "https://example.com/second",
+			"title": "Second",
+			"summary": "the summary",
+			"date_modified": "2024-09-04T08:00:00Z",
+			"author": {"name": "Carol"}
+		},
+		{
+			"id": "3",
+			"external_url": "https://elsewhere.example.com/third",
+			"content_html": "<p>only html</p>"
+		}
+	]
+}`
+
+func TestJSONFeedToRSS(t *testing.T) {
+	feed, err := parseFeed([]byte(jsonFeed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feed.Channel.Title != "Example" || feed.Channel.Link != "https://example.com/" || feed.Channel.Description != "an example feed" {
+		t.Errorf("channel = %q %q %q", feed.Channel.Title, feed.Channel.Link, feed.Channel.Description)
+	}
+	if len(feed.Channel.Item) != 3 {
+		t.Fatalf("got %d items, want 3", len(feed.Channel.Item))
+	}
+	first, second, third := feed.Channel.Item[0], feed.Channel.Item[1], feed.Channel.Item[2]
+
+	tests := []struct {
+		field string
+		got   string
+		want  string
+	}{
+		{"first guid", first.GUID.Value, "1"},
+		{"first isPermaLink", first.GUID.IsPermaLink, "false"},
+		{"first link", first.Link, "https://example.com/first"},
+		{"first description", first.Description, "the text"},
+		{"first content", first.Content, "<p>the html</p>"},
+		{"first pubDate", first.PubDate, "2024-09-03T16:05:00Z"},
+		{"first author", first.author(), "Alice, Bob"},
+		{"first image", first.Image.Href, "https://example.com/first.png"},
+		{"second link", second.Link, "https://example.com/second"},
+		{"second description", second.Description, "the summary"},
+		{"second pubDate", second.PubDate, "2024-09-04T08:00:00Z"},
+		{"second author", second.author(), "Carol"},
+		{"third link", third.Link, "https://elsewhere.example.com/third"},
+		{"third description", third.Description, "<p>only html</p>"},
+		{"third author", third.author(), "Feed Author"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.field, tt.got, tt.want)
+		}
+	}
+
+	if want := []string{"go", "feeds"}; !slices.Equal(first.Category, want) {
+		t.Errorf("first categories = %q, want %q", first.Category, want)
+	}
+	if len(first.MediaContent) != 1 {
+		t.Fatalf("first has %d attachments, want 1", len(first.MediaContent))
+	}
+	attachment := first.MediaContent[0]
+	if attachment.URL != "https://example.com/first.mp3" || attachment.Type != "audio/mpeg" ||
+		attachment.FileSize != "1234" || attachment.Duration != "61.5" {
+		t.Errorf("first attachment = %+v", attachment)
+	}
+}
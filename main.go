@@ -4,21 +4,28 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/LegendLoreLori/radgregator/internal/auth"
 	"github.com/LegendLoreLori/radgregator/internal/config"
 	"github.com/LegendLoreLori/radgregator/internal/database"
 	"github.com/google/uuid"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 type state struct {
-	db  *database.Queries
-	cfg *config.Config
+	db     *database.Queries
+	conn   *sql.DB
+	cfg    *config.Config
+	output outputFormat
 }
 
 type command struct {
@@ -30,6 +37,24 @@ type commands struct {
 	cmds map[string]func(*state, command) error
 }
 
+// parseFlags parses flags from anywhere in the command's arguments, not just
+// before the first positional one, and returns the positional arguments
+func (cmd command) parseFlags(fs *flag.FlagSet) ([]string, error) {
+	var positional []string
+	args := cmd.args[1:]
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
 func (c *commands) register(name string, f func(*state, command) error) {
 	c.cmds[name] = f
 }
@@ -45,9 +70,29 @@ func (c *commands) run(s *state, cmd command) error {
 	return nil
 }
 
+// userForKey finds the user that key belongs to, the name has to match too
+// so a key can't be used to log in under someone else's name
+func userForKey(ctx context.Context, s *state, name, key string) (database.User, error) {
+	if key == "" {
+		return database.User{}, errors.New("not logged in, run login USERNAME API_KEY")
+	}
+	user, err := s.db.GetUserByAPIKey(ctx, sql.NullString{
+		String: auth.HashAPIKey(key),
+		Valid:  true,
+	})
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && user.Name != name) {
+		return database.User{}, fmt.Errorf("invalid api key for %q", name)
+	} else if err != nil {
+		return database.User{}, err
+	}
+	return user, nil
+}
+
+// middlewareLoggedIn checks the api key saved by login on every command, a
+// name on its own in the config isn't trusted
 func middlewareLoggedIn(handler func(s *state, cmd command, user database.User) error) func(*state, command) error {
 	return func(s *state, cmd command) error {
-		user, err := s.db.GetUser(context.Background(), s.cfg.CurrentUserName)
+		user, err := userForKey(context.Background(), s, s.cfg.CurrentUserName, s.cfg.APIKey)
 		if err != nil {
 			return err
 		}
@@ -56,14 +101,18 @@ func middlewareLoggedIn(handler func(s *state, cmd command, user database.User)
 }
 
 func handlerLogin(s *state, cmd command) error {
-	if len(cmd.args) < 2 {
-		return errors.New("missing positional argument [USERNAME]")
+	if len(cmd.args) < 3 {
+		return errors.New("missing positional arguments [USERNAME] [API_KEY]")
 	}
-	if _, err := s.db.GetUser(context.Background(), cmd.args[1]); err != nil {
-		return fmt.Errorf("no user %q registered", cmd.args[1])
+	name, key := cmd.args[1], cmd.args[2]
+	if user, err := s.db.GetUser(context.Background(), name); err == nil && !user.ApiKeyHash.Valid {
+		return fmt.Errorf("%s has no api key yet, run rotate-key --user %s to issue one", name, name)
+	}
+	if _, err := userForKey(context.Background(), s, name, key); err != nil {
+		return err
 	}
 
-	if err := s.cfg.SetUser(cmd.args[1]); err != nil {
+	if err := s.cfg.SetUser(name, key); err != nil {
 		return fmt.Errorf("error calling config method SetUser: %w", err)
 	}
 	println("username set")
@@ -74,19 +123,80 @@ func handlerRegister(s *state, cmd command) error {
 		return errors.New("missing positional argument [USERNAME]")
 	}
 
+	key, hash, err := auth.MakeAPIKey()
+	if err != nil {
+		return err
+	}
 	user, err := s.db.CreateUser(context.Background(), database.CreateUserParams{
 		ID:        uuid.New(),
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 		Name:      cmd.args[1],
+		ApiKeyHash: sql.NullString{
+			String: hash,
+			Valid:  true,
+		},
 	})
 	if err != nil {
 		return err
 	}
 	fmt.Printf("user %s created\n", user.Name)
+	fmt.Printf("api key: %s\n(this won't be shown again, log in with login %s API_KEY)\n", key, user.Name)
 	log.Printf("user created: %+v\n", user)
 	return nil
 }
+
+// handlerRotateKey replaces the logged in user's key. users from before api
+// keys existed have no key to log in with, --user issues one to them, which
+// anyone with access to the database could do anyway
+func handlerRotateKey(s *state, cmd command) error {
+	fs := flag.NewFlagSet("rotate-key", flag.ContinueOnError)
+	userName := fs.String("user", "", "issue a first key to a user that doesn't have one")
+	if _, err := cmd.parseFlags(fs); err != nil {
+		return err
+	}
+
+	var user database.User
+	var err error
+	if *userName != "" {
+		user, err = s.db.GetUser(context.Background(), *userName)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("no user %q registered", *userName)
+		} else if err != nil {
+			return err
+		}
+		if user.ApiKeyHash.Valid {
+			return fmt.Errorf("%s already has an api key, log in as them and run rotate-key", user.Name)
+		}
+	} else {
+		user, err = userForKey(context.Background(), s, s.cfg.CurrentUserName, s.cfg.APIKey)
+		if err != nil {
+			return err
+		}
+	}
+
+	key, hash, err := auth.MakeAPIKey()
+	if err != nil {
+		return err
+	}
+	_, err = s.db.SetUserAPIKey(context.Background(), database.SetUserAPIKeyParams{
+		ID:        user.ID,
+		UpdatedAt: time.Now(),
+		ApiKeyHash: sql.NullString{
+			String: hash,
+			Valid:  true,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.cfg.SetUser(user.Name, key); err != nil {
+		return fmt.Errorf("error calling config method SetUser: %w", err)
+	}
+	fmt.Printf("new api key for %s: %s\n", user.Name, key)
+	log.Printf("api key rotated for user: %s\n", user.Name)
+	return nil
+}
 func handlerReset(s *state, _ command) error {
 	if err := s.db.ResetUsers(context.Background()); err != nil {
 		return err
@@ -98,7 +208,21 @@ func handlerList(s *state, _ command) error {
 	users, err := s.db.GetUsers(context.Background())
 	if err != nil {
 		return err
-	} else if len(users) == 0 {
+	}
+	if s.output != outputText {
+		records := make([]listedUser, 0, len(users))
+		for _, user := range users {
+			records = append(records, listedUser{
+				ID:        user.ID,
+				CreatedAt: user.CreatedAt,
+				UpdatedAt: user.UpdatedAt,
+				Name:      user.Name,
+				Current:   user.Name == s.cfg.CurrentUserName,
+			})
+		}
+		return printRecords(s.output, records)
+	}
+	if len(users) == 0 {
 		return errors.New("no users registered")
 	}
 
@@ -112,28 +236,73 @@ func handlerList(s *state, _ command) error {
 	return nil
 }
 func handlerAggregate(s *state, cmd command) error {
-	if len(cmd.args) < 2 {
-		return errors.New("missing positional argument [INTERVAL]")
-	}
-	interval, err := time.ParseDuration(cmd.args[1])
+	fs := flag.NewFlagSet("agg", flag.ContinueOnError)
+	workers := fs.Int("workers", 1, "number of feeds to fetch concurrently")
+	batchSize := fs.Int("batch", 10, "number of feeds each worker claims at a time")
+	once := fs.Bool("once", false, "fetch every due feed once and exit")
+	adaptive := fs.Bool("adaptive", false, "fetch feeds without their own interval as often as they post")
+	args, err := cmd.parseFlags(fs)
 	if err != nil {
 		return err
 	}
-	if interval < 5*time.Second {
-		return errors.New("input an interval greater than 5 seconds")
+	if *workers < 1 || *batchSize < 1 {
+		return errors.New("--workers and --batch must be at least 1")
+	}
+
+	// with --once the interval is optional, it's only used to schedule the
+	// next run for feeds on the default interval
+	sched := fetchSchedule{adaptive: *adaptive}
+	if len(args) < 1 && !*once {
+		return errors.New("missing positional argument [INTERVAL]")
+	} else if len(args) > 0 {
+		sched.interval, err = time.ParseDuration(args[0])
+		if err != nil {
+			return err
+		}
+		if sched.interval < 5*time.Second {
+			return errors.New("input an interval greater than 5 seconds")
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *once {
+		scrapeFeeds(ctx, s, *workers, *batchSize, sched)
+		deliverNotifications(ctx, s)
+		return nil
 	}
 
-	fmt.Printf("begin collecting feeds every %s\n", interval)
-	ticker := time.NewTicker(interval)
-	for ; ; <-ticker.C {
-		scrapeFeeds(context.Background(), s)
+	// feeds can have intervals shorter than the default, so due feeds are
+	// looked for at least every minute and each one is only fetched when its
+	// next_fetch_at has passed
+	fmt.Printf("begin collecting feeds every %s with %d workers\n", sched.interval, *workers)
+	ticker := time.NewTicker(min(sched.interval, minRefreshInterval))
+	defer ticker.Stop()
+	for {
+		scrapeFeeds(ctx, s, *workers, *batchSize, sched)
+		deliverNotifications(ctx, s)
+		select {
+		case <-ctx.Done():
+			println("stopped collecting feeds")
+			return nil
+		case <-ticker.C:
+		}
 	}
 }
 func handlerFeeds(s *state, _ command) error {
 	feeds, err := s.db.GetFeedsUsers(context.Background())
 	if err != nil {
 		return err
-	} else if len(feeds) == 0 {
+	}
+	if s.output != outputText {
+		records := make([]apiFeedUser, 0, len(feeds))
+		for _, feed := range feeds {
+			records = append(records, apiFeedUserFromDatabase(feed))
+		}
+		return printRecords(s.output, records)
+	}
+	if len(feeds) == 0 {
 		return errors.New("no feeds created")
 	}
 
@@ -143,6 +312,29 @@ func handlerFeeds(s *state, _ command) error {
 
 	return nil
 }
+func handlerFeedStatus(s *state, _ command) error {
+	feeds, err := s.db.GetUnhealthyFeeds(context.Background())
+	if err != nil {
+		return err
+	} else if len(feeds) == 0 {
+		println("all feeds healthy")
+		return nil
+	}
+
+	for _, feed := range feeds {
+		fmt.Printf(" * %s - %q - %d consecutive failures\n", feed.Name, feed.Url, feed.FailureCount)
+		if feed.LastStatus.Valid {
+			fmt.Printf("   last status: %d\n", feed.LastStatus.Int32)
+		}
+		fmt.Printf("   last error: %s\n", feed.LastError.String)
+		fmt.Printf("   refresh interval: %s\n", formatInterval(feed))
+		if feed.NextFetchAt.Valid {
+			fmt.Printf("   next attempt: %s\n", feed.NextFetchAt.Time.Format(time.RFC1123))
+		}
+	}
+
+	return nil
+}
 func handlerKillFeed(s *state, cmd command) error {
 	if len(cmd.args) < 2 {
 		return errors.New("missing positional arguments [URL]")
@@ -159,16 +351,32 @@ func handlerKillFeed(s *state, cmd command) error {
 }
 
 func handlerAddFeed(s *state, cmd command, user database.User) error {
-	if len(cmd.args) < 3 {
+	if len(cmd.args) < 2 {
 		return errors.New("missing positional arguments [NAME] [URL]")
 	}
+	// the name is optional, a lone argument is the url
+	name, pageUrl := "", cmd.args[1]
+	if len(cmd.args) >= 3 {
+		name, pageUrl = cmd.args[1], cmd.args[2]
+	}
+
+	feedUrl, rssFeed, err := discoverFeed(context.Background(), pageUrl)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		name = strings.TrimSpace(rssFeed.Channel.Title)
+	}
+	if name == "" {
+		name = feedUrl
+	}
 
 	feed, err := s.db.CreateFeed(context.Background(), database.CreateFeedParams{
 		ID:        uuid.New(),
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
-		Name:      cmd.args[1],
-		Url:       cmd.args[2],
+		Name:      name,
+		Url:       feedUrl,
 		UserID:    user.ID,
 	})
 	if err != nil {
@@ -195,6 +403,17 @@ func handlerFollow(s *state, cmd command, user database.User) error {
 	}
 
 	feed, err := s.db.GetFeed(context.Background(), cmd.args[1])
+	if errors.Is(err, sql.ErrNoRows) {
+		// not a feed we know about, it might be a page pointing at one
+		feedUrl, _, discoverErr := discoverFeed(context.Background(), cmd.args[1])
+		if discoverErr != nil {
+			return fmt.Errorf("no feed %q added: %w", cmd.args[1], discoverErr)
+		}
+		feed, err = s.db.GetFeed(context.Background(), feedUrl)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("no feed %q added, add it with add-feed", feedUrl)
+		}
+	}
 	if err != nil {
 		return err
 	}
@@ -209,27 +428,104 @@ func handlerFollow(s *state, cmd command, user database.User) error {
 		return err
 	}
 
+	filterFollowedFeed(context.Background(), s, user.ID, feed.ID)
+
 	// I feel like i've missed the point here but oh well
 	fmt.Printf("user: %s now following %q\n", feedFollow.UserName, feedFollow.FeedName)
 	log.Printf("feed_follow created: %+v\n", feedFollow)
 	return nil
 }
-func handlerFollowing(s *state, _ command, user database.User) error {
-	following, err := s.db.GetFeedFollowsForUser(context.Background(), user.Name)
+func handlerFollowing(s *state, cmd command, user database.User) error {
+	fs := flag.NewFlagSet("following", flag.ContinueOnError)
+	tag := fs.String("tag", "", "only list feeds with this tag")
+	if _, err := cmd.parseFlags(fs); err != nil {
+		return err
+	}
+
+	following, err := s.db.GetFeedFollowsForUser(context.Background(), database.GetFeedFollowsForUserParams{
+		Name: user.Name,
+		Tag: sql.NullString{
+			String: *tag,
+			Valid:  *tag != "",
+		},
+	})
 	if err != nil {
 		return err
 	}
-	fmt.Printf("all feeds %s is following:\n", user.Name)
+	if s.output != outputText {
+		records := make([]apiFollowedFeed, 0, len(following))
+		for _, follow := range following {
+			records = append(records, apiFollowedFeedFromDatabase(follow))
+		}
+		return printRecords(s.output, records)
+	}
+	if *tag != "" {
+		fmt.Printf("all feeds %s is following tagged %q:\n", user.Name, *tag)
+	} else {
+		fmt.Printf("all feeds %s is following:\n", user.Name)
+	}
 	if len(following) == 0 {
-		fmt.Printf("%+v", following)
 		println(" * none!")
 	}
 	for i := 0; i < len(following); i++ {
+		if len(following[i].Tags) > 0 {
+			fmt.Printf(" * %q [%s]\n", following[i].FeedName, strings.Join(following[i].Tags, ", "))
+			continue
+		}
 		fmt.Printf(" * %q\n", following[i].FeedName)
 	}
 
 	return nil
 }
+func handlerTag(s *state, cmd command, user database.User) error {
+	if len(cmd.args) < 3 {
+		return errors.New("missing positional arguments [URL] [TAG...]")
+	}
+
+	for _, tag := range cmd.args[2:] {
+		tagged, err := s.db.TagFeedFollow(context.Background(), database.TagFeedFollowParams{
+			Tag:    tag,
+			UserID: user.ID,
+			Url:    cmd.args[1],
+		})
+		if err != nil {
+			return err
+		}
+		if tagged == 0 {
+			if _, err := s.db.GetFeed(context.Background(), cmd.args[1]); errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("no feed %q added", cmd.args[1])
+			}
+			fmt.Printf("%q already tagged %q or not followed\n", cmd.args[1], tag)
+			continue
+		}
+		fmt.Printf("tagged %q %q\n", cmd.args[1], tag)
+	}
+
+	return nil
+}
+func handlerUntag(s *state, cmd command, user database.User) error {
+	if len(cmd.args) < 3 {
+		return errors.New("missing positional arguments [URL] [TAG...]")
+	}
+
+	for _, tag := range cmd.args[2:] {
+		untagged, err := s.db.UntagFeedFollow(context.Background(), database.UntagFeedFollowParams{
+			UserID: user.ID,
+			Url:    cmd.args[1],
+			Tag:    tag,
+		})
+		if err != nil {
+			return err
+		}
+		if untagged == 0 {
+			fmt.Printf("%q isn't tagged %q\n", cmd.args[1], tag)
+			continue
+		}
+		fmt.Printf("untagged %q %q\n", cmd.args[1], tag)
+	}
+
+	return nil
+}
 func handlerUnfollow(s *state, cmd command, user database.User) error {
 	if len(cmd.args) < 2 {
 		return errors.New("missing positional argument [URL]")
@@ -248,33 +544,388 @@ func handlerUnfollow(s *state, cmd command, user database.User) error {
 	return nil
 }
 func handlerBrowse(s *state, cmd command, user database.User) error {
+	fs := flag.NewFlagSet("browse", flag.ContinueOnError)
+	includeRead := fs.Bool("include-read", false, "include posts that have already been read")
+	tag := fs.String("tag", "", "only show posts from feeds with this tag")
+	author := fs.String("author", "", "only show posts whose author contains this")
+	category := fs.String("category", "", "only show posts in this category")
+	media := fs.Bool("media", false, "only show posts with media and list their enclosures")
+	includeHidden := fs.Bool("include-hidden", false, "include posts hidden by filter rules")
+	sortBy := fs.String("sort", "published", "sort by published or fetched date")
+	order := fs.String("order", "desc", "asc or desc")
+	since := fs.String("since", "", "only show posts published (or fetched with --sort fetched) on or after YYYY-MM-DD")
+	until := fs.String("until", "", "only show posts published (or fetched with --sort fetched) before YYYY-MM-DD")
+	feedUrl := fs.String("feed", "", "only show posts from the feed with this url")
+	cursor := fs.String("cursor", "", "continue from the cursor printed after the previous page")
+	args, err := cmd.parseFlags(fs)
+	if err != nil {
+		return err
+	}
 	var limit int
-	if len(cmd.args) < 2 {
+	if len(args) < 1 {
 		limit = 2
 	} else {
-		var err error
-		limit, err = strconv.Atoi(cmd.args[1])
+		limit, err = strconv.Atoi(args[0])
 		if err != nil {
 			return err
 		}
 	}
 
-	posts, err := s.db.GetPostsForUser(context.Background(), database.GetPostsForUserParams{
-		UserID: user.ID,
-		Limit:  int32(limit),
-	})
+	params := postQuery{}
+	params.GetPostsForUserByPublishedParams = database.GetPostsForUserByPublishedParams{
+		UserID:        user.ID,
+		IncludeRead:   *includeRead,
+		IncludeHidden: *includeHidden,
+		Tag: sql.NullString{
+			String: *tag,
+			Valid:  *tag != "",
+		},
+		Author: sql.NullString{
+			String: *author,
+			Valid:  *author != "",
+		},
+		Category: sql.NullString{
+			String: *category,
+			Valid:  *category != "",
+		},
+		MediaOnly: *media,
+		Limit:     int32(limit),
+	}
+	if params.SortBy, params.Descending, err = parsePostSort(*sortBy, *order); err != nil {
+		return err
+	}
+	if params.Since, err = parseDateFlag("since", *since); err != nil {
+		return err
+	}
+	if params.Until, err = parseDateFlag("until", *until); err != nil {
+		return err
+	}
+	if *feedUrl != "" {
+		feed, err := s.db.GetFeed(context.Background(), *feedUrl)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("no feed found for %q", *feedUrl)
+		} else if err != nil {
+			return err
+		}
+		params.FeedID = uuid.NullUUID{
+			UUID:  feed.ID,
+			Valid: true,
+		}
+	}
+	if err := applyCursor(&params, *cursor); err != nil {
+		return err
+	}
+
+	posts, err := getPostsForUser(context.Background(), s.db, params)
 	if err != nil {
 		return err
 	}
+	next := nextCursor(params, posts)
+
+	enclosures := make(map[uuid.UUID][]database.PostEnclosure)
+	if *media && len(posts) > 0 {
+		ids := make([]uuid.UUID, 0, len(posts))
+		for _, post := range posts {
+			ids = append(ids, post.ID)
+		}
+		found, err := s.db.GetEnclosuresForPosts(context.Background(), ids)
+		if err != nil {
+			return err
+		}
+		for _, e := range found {
+			enclosures[e.PostID] = append(enclosures[e.PostID], e)
+		}
+	}
+	if s.output != outputText {
+		records := make([]apiPost, 0, len(posts))
+		for _, post := range posts {
+			records = append(records, apiPostFromDatabase(post))
+		}
+		// stdout is only records so the cursor goes to stderr
+		if next != "" {
+			fmt.Fprintf(os.Stderr, "next cursor: %s\n", next)
+		}
+		return printRecords(s.output, records)
+	}
+	if len(posts) == 0 && *includeRead {
+		println("no posts")
+	} else if len(posts) == 0 {
+		println("no unread posts")
+	}
 
 	for _, post := range posts {
 		fmt.Printf("\n * %s\n", post.FeedName)
+		var marks []string
+		if post.ReadAt.Valid {
+			marks = append(marks, "read")
+		}
+		if post.Highlighted {
+			marks = append(marks, "highlighted")
+		}
+		if len(marks) > 0 {
+			fmt.Printf("%s (%s)\n", post.ID, strings.Join(marks, ", "))
+		} else {
+			fmt.Printf("%s\n", post.ID)
+		}
 		fmt.Printf("%s - %s\n", post.Title.String, post.Url)
+		if post.Author.Valid {
+			fmt.Printf("by %s\n", post.Author.String)
+		}
+		if len(post.Categories) > 0 {
+			fmt.Printf("in %s\n", strings.Join(post.Categories, ", "))
+		}
+		if *media && post.ImageUrl.Valid {
+			fmt.Printf("image: %s\n", post.ImageUrl.String)
+		}
+		for _, e := range enclosures[post.ID] {
+			fmt.Printf(" - %s\n", formatEnclosure(e))
+		}
 		println(post.Description.String)
 		if post.PublishedAt.Valid {
 			fmt.Printf("%s\n", post.PublishedAt.Time)
 		}
 	}
+	if next != "" {
+		fmt.Printf("\nmore posts with --cursor %s\n", next)
+	}
+
+	return nil
+}
+
+// parseMarkArgs reads the target of mark-read and mark-unread, either a
+// single post id or every post in a feed with --all --feed URL
+func parseMarkArgs(cmd command) (uuid.UUID, string, error) {
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	all := fs.Bool("all", false, "mark every post in --feed")
+	feedUrl := fs.String("feed", "", "url of the feed to mark with --all")
+	args, err := cmd.parseFlags(fs)
+	if err != nil {
+		return uuid.Nil, "", err
+	}
+	if *all {
+		if *feedUrl == "" {
+			return uuid.Nil, "", errors.New("--all requires --feed URL")
+		}
+		return uuid.Nil, *feedUrl, nil
+	}
+	if len(args) < 1 {
+		return uuid.Nil, "", errors.New("missing positional argument [POST_ID] or --all --feed URL")
+	}
+	postID, err := uuid.Parse(args[0])
+	if err != nil {
+		return uuid.Nil, "", fmt.Errorf("invalid post id %q: %w", args[0], err)
+	}
+	return postID, "", nil
+}
+func handlerMarkRead(s *state, cmd command, user database.User) error {
+	postID, feedUrl, err := parseMarkArgs(cmd)
+	if err != nil {
+		return err
+	}
+
+	var marked int64
+	if feedUrl != "" {
+		marked, err = s.db.MarkFeedPostsRead(context.Background(), database.MarkFeedPostsReadParams{
+			UserID: user.ID,
+			ReadAt: time.Now(),
+			Url:    feedUrl,
+		})
+	} else {
+		marked, err = s.db.MarkPostRead(context.Background(), database.MarkPostReadParams{
+			UserID: user.ID,
+			PostID: postID,
+			ReadAt: time.Now(),
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("marked %d posts read\n", marked)
+	return nil
+}
+func handlerMarkUnread(s *state, cmd command, user database.User) error {
+	postID, feedUrl, err := parseMarkArgs(cmd)
+	if err != nil {
+		return err
+	}
+
+	var marked int64
+	if feedUrl != "" {
+		marked, err = s.db.MarkFeedPostsUnread(context.Background(), database.MarkFeedPostsUnreadParams{
+			UserID: user.ID,
+			Url:    feedUrl,
+		})
+	} else {
+		marked, err = s.db.MarkPostUnread(context.Background(), database.MarkPostUnreadParams{
+			UserID: user.ID,
+			PostID: postID,
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("marked %d posts unread\n", marked)
+	return nil
+}
+func handlerSave(s *state, cmd command, user database.User) error {
+	if len(cmd.args) < 2 {
+		return errors.New("missing positional argument [POST_ID|URL]")
+	}
+
+	postID, err := uuid.Parse(cmd.args[1])
+	if err != nil {
+		post, err := s.db.GetPostByUrl(context.Background(), cmd.args[1])
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("no post found for %q", cmd.args[1])
+		} else if err != nil {
+			return err
+		}
+		postID = post.ID
+	}
+
+	saved, err := s.db.SavePost(context.Background(), database.SavePostParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UserID:    user.ID,
+		PostID:    postID,
+	})
+	var sqlErr *pq.Error
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("no post found for %q", cmd.args[1])
+	} else if errors.As(err, &sqlErr) && sqlErr.Code == "23505" { // duplicate key entry
+		return fmt.Errorf("post %q already saved", cmd.args[1])
+	} else if err != nil {
+		return err
+	}
+
+	fmt.Printf("saved %q\n", saved.Title.String)
+	log.Printf("saved_post created: %+v\n", saved)
+	return nil
+}
+func handlerUnsave(s *state, cmd command, user database.User) error {
+	if len(cmd.args) < 2 {
+		return errors.New("missing positional argument [POST_ID|URL]")
+	}
+
+	params := database.DeleteSavedPostParams{UserID: user.ID}
+	if postID, err := uuid.Parse(cmd.args[1]); err == nil {
+		params.PostID = uuid.NullUUID{
+			UUID:  postID,
+			Valid: true,
+		}
+	} else {
+		params.Url = cmd.args[1]
+	}
+	deleted, err := s.db.DeleteSavedPost(context.Background(), params)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("no saved post for %q", cmd.args[1])
+	} else if err != nil {
+		return err
+	}
+
+	fmt.Printf("unsaved %q\n", deleted.Title.String)
+	log.Printf("saved_post deleted: %+v\n", deleted)
+	return nil
+}
+func handlerSaved(s *state, _ command, user database.User) error {
+	saved, err := s.db.GetSavedPostsForUser(context.Background(), user.ID)
+	if err != nil {
+		return err
+	} else if len(saved) == 0 {
+		println("no saved posts")
+		return nil
+	}
+
+	for _, post := range saved {
+		fmt.Printf("\n * %s\n", post.FeedName)
+		fmt.Printf("%s - %s\n", post.Title.String, post.Url)
+		if post.PublishedAt.Valid {
+			fmt.Printf("%s\n", post.PublishedAt.Time)
+		}
+	}
+
+	return nil
+}
+
+// parseDateFlag parses a YYYY-MM-DD date given to a flag, empty means unset
+func parseDateFlag(name, value string) (sql.NullTime, error) {
+	if value == "" {
+		return sql.NullTime{}, nil
+	}
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return sql.NullTime{}, fmt.Errorf("invalid --%s date %q, expected YYYY-MM-DD", name, value)
+	}
+	return sql.NullTime{
+		Time:  t,
+		Valid: true,
+	}, nil
+}
+func handlerSearch(s *state, cmd command, user database.User) error {
+	fs := flag.NewFlagSet("search", flag.ContinueOnError)
+	feedUrl := fs.String("feed", "", "only search posts from the feed with this url")
+	since := fs.String("since", "", "only search posts published on or after YYYY-MM-DD")
+	until := fs.String("until", "", "only search posts published before YYYY-MM-DD")
+	author := fs.String("author", "", "only search posts whose author contains this")
+	category := fs.String("category", "", "only search posts in this category")
+	followed := fs.Bool("followed", false, "only search feeds you follow")
+	includeHidden := fs.Bool("include-hidden", false, "include posts hidden by filter rules")
+	limit := fs.Int("limit", 10, "maximum number of results")
+	args, err := cmd.parseFlags(fs)
+	if err != nil {
+		return err
+	}
+	if len(args) < 1 {
+		return errors.New("missing positional argument [QUERY]")
+	}
+
+	params := database.SearchPostsParams{
+		Query: strings.Join(args, " "),
+		FeedUrl: sql.NullString{
+			String: *feedUrl,
+			Valid:  *feedUrl != "",
+		},
+		Author: sql.NullString{
+			String: *author,
+			Valid:  *author != "",
+		},
+		Category: sql.NullString{
+			String: *category,
+			Valid:  *category != "",
+		},
+		FollowedOnly:  *followed,
+		IncludeHidden: *includeHidden,
+		UserID:        user.ID,
+		Limit:         int32(*limit),
+	}
+	if params.Since, err = parseDateFlag("since", *since); err != nil {
+		return err
+	}
+	if params.Until, err = parseDateFlag("until", *until); err != nil {
+		return err
+	}
+
+	results, err := s.db.SearchPosts(context.Background(), params)
+	if err != nil {
+		return err
+	} else if len(results) == 0 {
+		fmt.Printf("no posts matching %q\n", params.Query)
+		return nil
+	}
+
+	for _, post := range results {
+		fmt.Printf("\n * %s - %s (%.2f)\n", post.FeedName, post.ID, post.Rank)
+		fmt.Printf("%s - %s\n", post.Title.String, post.Url)
+		if post.Author.Valid {
+			fmt.Printf("by %s\n", post.Author.String)
+		}
+		println(post.Snippet)
+		if post.PublishedAt.Valid {
+			fmt.Printf("%s\n", post.PublishedAt.Time)
+		}
+	}
 
 	return nil
 }
@@ -299,26 +950,65 @@ func main() {
 	}
 	dbQueries := database.New(db)
 
-	s := state{dbQueries, &cfg}
+	s := state{
+		db:     dbQueries,
+		conn:   db,
+		cfg:    &cfg,
+		output: outputText,
+	}
 	c := commands{make(map[string]func(*state, command) error)}
 	c.register("login", handlerLogin)
 	c.register("register", handlerRegister)
+	c.register("rotate-key", handlerRotateKey)
 	c.register("reset", handlerReset)
 	c.register("list", handlerList)
 	c.register("agg", handlerAggregate)
 	c.register("add-feed", middlewareLoggedIn(handlerAddFeed))
 	c.register("kill-feed", handlerKillFeed)
 	c.register("feeds", handlerFeeds)
+	c.register("feed-status", handlerFeedStatus)
+	c.register("set-interval", handlerSetInterval)
 	c.register("follow", middlewareLoggedIn(handlerFollow))
 	c.register("following", middlewareLoggedIn(handlerFollowing))
 	c.register("unfollow", middlewareLoggedIn(handlerUnfollow))
+	c.register("tag", middlewareLoggedIn(handlerTag))
+	c.register("untag", middlewareLoggedIn(handlerUntag))
 	c.register("browse", middlewareLoggedIn(handlerBrowse))
-
-	if len(os.Args) < 2 {
-		fmt.Println("missing command name\n usage: radgregate COMMAND [...ARGS]")
+	c.register("mark-read", middlewareLoggedIn(handlerMarkRead))
+	c.register("mark-unread", middlewareLoggedIn(handlerMarkUnread))
+	c.register("save", middlewareLoggedIn(handlerSave))
+	c.register("unsave", middlewareLoggedIn(handlerUnsave))
+	c.register("saved", middlewareLoggedIn(handlerSaved))
+	c.register("search", middlewareLoggedIn(handlerSearch))
+	c.register("download", middlewareLoggedIn(handlerDownload))
+	c.register("tui", middlewareLoggedIn(handlerTUI))
+	c.register("notify", middlewareLoggedIn(handlerNotify))
+	c.register("unnotify", middlewareLoggedIn(handlerUnnotify))
+	c.register("notifications", middlewareLoggedIn(handlerNotifications))
+	c.register("notification-log", middlewareLoggedIn(handlerNotificationLog))
+	c.register("filter", middlewareLoggedIn(handlerFilter))
+	c.register("import-opml", middlewareLoggedIn(handlerImportOPML))
+	c.register("export-opml", middlewareLoggedIn(handlerExportOPML))
+	c.register("serve", handlerServe)
+	c.register("migrate", handlerMigrate)
+
+	output, args, err := extractOutputFlag(os.Args[1:])
+	if err != nil {
+		fmt.Println(err)
 		os.Exit(1)
 	}
-	cmd := command{os.Args[1], os.Args[1:]}
+	if len(args) < 1 {
+		fmt.Println("missing command name\n usage: radgregate [--output text|json|csv|table] COMMAND [...ARGS]")
+		os.Exit(1)
+	}
+	s.output = output
+	cmd := command{args[0], args}
+	if cmd.name != "migrate" {
+		if err := checkSchema(&s); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
 	if err := c.run(&s, cmd); err != nil {
 		fmt.Println(err)
 		os.Exit(1)
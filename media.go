@@ -0,0 +1,425 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/LegendLoreLori/radgregator/internal/database"
+	"github.com/google/uuid"
+)
+
+type RSSEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Type   string `xml:"type,attr"`
+	Length string `xml:"length,attr"`
+}
+
+type ITunesImage struct {
+	Href string `xml:"href,attr"`
+}
+
+type MediaContent struct {
+	URL      string      `xml:"url,attr"`
+	Type     string      `xml:"type,attr"`
+	FileSize string      `xml:"fileSize,attr"`
+	Duration string      `xml:"duration,attr"`
+	Hash     []MediaHash `xml:"http://search.yahoo.com/mrss/ hash"`
+}
+
+// MediaGroup holds several versions of the same media, a hash on the group
+// applies to every content in it
+type MediaGroup struct {
+	Content []MediaContent `xml:"http://search.yahoo.com/mrss/ content"`
+	Hash    []MediaHash    `xml:"http://search.yahoo.com/mrss/ hash"`
+}
+
+// MediaHash algo defaults to md5 when it's missing
+type MediaHash struct {
+	Algo  string `xml:"algo,attr"`
+	Value string `xml:",chardata"`
+}
+
+// enclosure is a piece of media attached to an item regardless of which
+// element it came from, checksum is "algo:hex"
+type enclosure struct {
+	url      string
+	mimeType string
+	length   int64
+	duration int
+	checksum string
+}
+
+// parseDuration reads an itunes:duration, either a number of seconds or
+// [HH:]MM:SS, 0 means unknown
+func parseDuration(value string) int {
+	parts := strings.Split(strings.TrimSpace(value), ":")
+	if len(parts) > 3 {
+		return 0
+	}
+	total := 0.0
+	for _, part := range parts {
+		n, err := strconv.ParseFloat(part, 64)
+		if err != nil || n < 0 {
+			return 0
+		}
+		total = total*60 + n
+	}
+	return int(total)
+}
+
+func parseLength(value string) int64 {
+	n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+func mediaChecksum(hashes []MediaHash) string {
+	for _, h := range hashes {
+		algo := strings.ReplaceAll(strings.ToLower(strings.TrimSpace(h.Algo)), "-", "")
+		if algo == "" {
+			algo = "md5"
+		}
+		value := strings.ToLower(strings.TrimSpace(h.Value))
+		if value != "" && newHash(algo) != nil {
+			return algo + ":" + value
+		}
+	}
+	return ""
+}
+
+func newHash(algo string) hash.Hash {
+	switch algo {
+	case "md5":
+		return md5.New()
+	case "sha1":
+		return sha1.New()
+	case "sha256":
+		return sha256.New()
+	}
+	return nil
+}
+
+// enclosures merges an item's <enclosure> and media:content elements, feeds
+// often list the same file in both so they're matched up by url
+func (item RSSItem) enclosures() []enclosure {
+	var found []enclosure
+	add := func(e enclosure) {
+		e.url = strings.TrimSpace(e.url)
+		if e.url == "" {
+			return
+		}
+		for i := range found {
+			if found[i].url != e.url {
+				continue
+			}
+			if found[i].mimeType == "" {
+				found[i].mimeType = e.mimeType
+			}
+			if found[i].length == 0 {
+				found[i].length = e.length
+			}
+			if found[i].duration == 0 {
+				found[i].duration = e.duration
+			}
+			if found[i].checksum == "" {
+				found[i].checksum = e.checksum
+			}
+			return
+		}
+		found = append(found, e)
+	}
+
+	// itunes:duration is per item, it describes the episode's enclosure
+	duration := parseDuration(item.Duration)
+	for _, e := range item.Enclosure {
+		add(enclosure{
+			url:      e.URL,
+			mimeType: e.Type,
+			length:   parseLength(e.Length),
+			duration: duration,
+		})
+	}
+	addContent := func(content MediaContent, groupHash []MediaHash) {
+		checksum := mediaChecksum(content.Hash)
+		if checksum == "" {
+			checksum = mediaChecksum(groupHash)
+		}
+		add(enclosure{
+			url:      content.URL,
+			mimeType: content.Type,
+			length:   parseLength(content.FileSize),
+			duration: parseDuration(content.Duration),
+			checksum: checksum,
+		})
+	}
+	for _, content := range item.MediaContent {
+		addContent(content, nil)
+	}
+	for _, group := range item.MediaGroup {
+		for _, content := range group.Content {
+			addContent(content, group.Hash)
+		}
+	}
+	return found
+}
+
+func formatEnclosure(e database.PostEnclosure) string {
+	var details []string
+	if e.MimeType.Valid {
+		details = append(details, e.MimeType.String)
+	}
+	if e.Length.Valid && e.Length.Int64 > 0 {
+		details = append(details, fmt.Sprintf("%.1f MB", float64(e.Length.Int64)/(1<<20)))
+	}
+	if e.DurationSeconds.Valid && e.DurationSeconds.Int32 > 0 {
+		details = append(details, (time.Duration(e.DurationSeconds.Int32) * time.Second).String())
+	}
+	if len(details) == 0 {
+		return e.Url
+	}
+	return fmt.Sprintf("%s [%s]", e.Url, strings.Join(details, ", "))
+}
+
+// downloadClient shares the feed transport but has no overall timeout since
+// an episode can take a lot longer than 30 seconds to come down
+var downloadClient = &http.Client{
+	Transport: feedClient.Transport,
+}
+
+// safeFileName strips anything that can't go in a file name on the common
+// filesystems
+func safeFileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r < ' ' {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(name))
+	if name == "" || name == "." || name == ".." {
+		return "_"
+	}
+	return name
+}
+
+// enclosureFileName is the post id followed by the last segment of the
+// enclosure's url, plenty of feeds name every episode media.mp3 or download
+// so the url alone would have posts overwriting each other. urls without a
+// usable segment get an extension guessed from the mime type instead
+func enclosureFileName(postID uuid.UUID, e database.PostEnclosure) string {
+	if u, err := url.Parse(e.Url); err == nil {
+		if base := path.Base(u.Path); base != "." && base != "/" {
+			return postID.String() + "-" + safeFileName(base)
+		}
+	}
+	name := postID.String()
+	if exts, _ := mime.ExtensionsByType(e.MimeType.String); len(exts) > 0 {
+		name += exts[0]
+	}
+	return name
+}
+
+func fileChecksum(filePath, algo string) (string, error) {
+	h := newHash(algo)
+	if h == nil {
+		return "", fmt.Errorf("unsupported checksum algorithm %q", algo)
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return algo + ":" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// verifyChecksum compares the file against the enclosure's checksum, when the
+// enclosure doesn't have one yet the file's sha256 is returned to be recorded
+func verifyChecksum(filePath string, expected sql.NullString) (string, error) {
+	algo := "sha256"
+	if expected.Valid {
+		algo, _, _ = strings.Cut(expected.String, ":")
+	}
+	actual, err := fileChecksum(filePath, algo)
+	if err != nil {
+		return "", err
+	}
+	if expected.Valid && actual != expected.String {
+		return "", fmt.Errorf("checksum mismatch, expected %s got %s", expected.String, actual)
+	}
+	return actual, nil
+}
+
+// downloadEnclosure fetches the enclosure into a .part file next to
+// filePath, picking up where a previous attempt left off if the server
+// supports range requests, then checks it before moving it into place
+func downloadEnclosure(ctx context.Context, e database.PostEnclosure, filePath string) (string, error) {
+	partPath := filePath + ".part"
+	var offset int64
+	if info, err := os.Stat(partPath); err == nil {
+		offset = info.Size()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", e.Url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", "radgregator")
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	res, err := downloadClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch {
+	case res.StatusCode == http.StatusPartialContent:
+		fmt.Printf("resuming from %d bytes\n", offset)
+		flags |= os.O_APPEND
+	case res.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// the part file already has everything, it only needs checking
+		return finishDownload(partPath, filePath, e.Checksum)
+	case res.StatusCode >= 200 && res.StatusCode <= 299:
+		// the server ignored the range so start over
+		offset = 0
+		flags |= os.O_TRUNC
+	default:
+		return "", &statusError{StatusCode: res.StatusCode}
+	}
+
+	file, err := os.OpenFile(partPath, flags, 0644)
+	if err != nil {
+		return "", err
+	}
+	written, err := io.Copy(file, res.Body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("download interrupted after %d bytes, run download again to resume: %w", offset+written, err)
+	}
+	if res.ContentLength >= 0 && written != res.ContentLength {
+		return "", fmt.Errorf("download incomplete, got %d of %d bytes, run download again to resume", written, res.ContentLength)
+	}
+
+	return finishDownload(partPath, filePath, e.Checksum)
+}
+
+func finishDownload(partPath, filePath string, expected sql.NullString) (string, error) {
+	checksum, err := verifyChecksum(partPath, expected)
+	if err != nil {
+		// a corrupt part file can't be resumed, the next attempt starts fresh
+		os.Remove(partPath)
+		return "", err
+	}
+	if err := os.Rename(partPath, filePath); err != nil {
+		return "", err
+	}
+	return checksum, nil
+}
+
+func handlerDownload(s *state, cmd command, _ database.User) error {
+	defaultDir, err := s.cfg.DownloadPath()
+	if err != nil {
+		return err
+	}
+	fs := flag.NewFlagSet("download", flag.ContinueOnError)
+	dir := fs.String("dir", defaultDir, "directory to save enclosures in")
+	args, err := cmd.parseFlags(fs)
+	if err != nil {
+		return err
+	}
+	if len(args) < 1 {
+		return errors.New("missing positional argument [POST_ID]")
+	}
+	postID, err := uuid.Parse(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid post id %q: %w", args[0], err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	post, err := s.db.GetPostByID(ctx, postID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("no post found for %q", args[0])
+	} else if err != nil {
+		return err
+	}
+	enclosures, err := s.db.GetEnclosuresForPosts(ctx, []uuid.UUID{postID})
+	if err != nil {
+		return err
+	}
+	if len(enclosures) == 0 {
+		return fmt.Errorf("post %q has no media to download", post.Title.String)
+	}
+
+	feedDir := filepath.Join(*dir, safeFileName(post.FeedName))
+	if err := os.MkdirAll(feedDir, 0755); err != nil {
+		return err
+	}
+	used := make(map[string]bool)
+	for i, e := range enclosures {
+		// a post can have several enclosures whose urls end the same way
+		name := enclosureFileName(postID, e)
+		if used[name] {
+			name = fmt.Sprintf("%d-%s", i+1, name)
+		}
+		used[name] = true
+		filePath := filepath.Join(feedDir, name)
+		var checksum string
+		if _, err := os.Stat(filePath); err == nil {
+			if checksum, err = verifyChecksum(filePath, e.Checksum); err != nil {
+				return fmt.Errorf("%s is already downloaded but doesn't match: %w", filePath, err)
+			}
+			fmt.Printf("already downloaded %s\n", filePath)
+		} else {
+			fmt.Printf("downloading %s to %s\n", e.Url, filePath)
+			if checksum, err = downloadEnclosure(ctx, e, filePath); err != nil {
+				return err
+			}
+			fmt.Printf("saved %s (%s)\n", filePath, checksum)
+		}
+
+		if !e.Checksum.Valid {
+			err := s.db.SetEnclosureChecksum(context.WithoutCancel(ctx), database.SetEnclosureChecksumParams{
+				ID: e.ID,
+				Checksum: sql.NullString{
+					String: checksum,
+					Valid:  true,
+				},
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/xml"
+	"testing"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int
+	}{
+		{"", 0},
+		{"90", 90},
+		{" 90 ", 90},
+		{"90.7", 90},
+		{"1:30", 90},
+		{"01:01:30", 3690},
+		{"1:00:00", 3600},
+		{"0:00", 0},
+		{"1:2:3:4", 0},
+		{"-5", 0},
+		{"1:-5", 0},
+		{"an hour", 0},
+		{"1::30", 0},
+	}
+
+	for _, tt := range tests {
+		if got := parseDuration(tt.value); got != tt.want {
+			t.Errorf("parseDuration(%q) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+const mediaItem = `<item xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd" xmlns:media="http://search.yahoo.com/mrss/">
+	<title>Episode</title>
+	<itunes:duration>1:02:03</itunes:duration>
+	<enclosure url="https://example.com/episode.mp3" type="audio/mpeg" length="1234"/>
+	<enclosure url=" " type="audio/mpeg"/>
+	<media:content url="https://example.com/episode.mp3" fileSize="9999" duration="10">
+		<media:hash algo="sha-256">ABCDEF</media:hash>
+	</media:content>
+	<media:content url="https://example.com/cover.jpg" type="image/jpeg" fileSize="-1">
+		<media:hash algo="crc32">0000</media:hash>
+	</media:content>
+	<media:group>
+		<media:hash>0123abcd</media:hash>
+		<media:content url="https://example.com/episode.ogg" type="audio/ogg" fileSize="2048" duration="3723"/>
+		<media:content url="https://example.com/episode.opus" type="audio/opus">
+			<media:hash algo="SHA1">FFFF</media:hash>
+		</media:content>
+	</media:group>
+</item>`
+
+func TestEnclosures(t *testing.T) {
+	var item RSSItem
+	if err := xml.Unmarshal([]byte(mediaItem), &item); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []enclosure{
+		// the media:content for the same url only fills in what the
+		// enclosure left out
+		{"https://example.com/episode.mp3", "audio/mpeg", 1234, 3723, "sha256:abcdef"},
+		// unknown hash algorithms are ignored
+		{"https://example.com/cover.jpg", "image/jpeg", 0, 0, ""},
+		// the group's hash applies when the content has none of its own
+		{"https://example.com/episode.ogg", "audio/ogg", 2048, 3723, "md5:0123abcd"},
+		{"https://example.com/episode.opus", "audio/opus", 0, 0, "sha1:ffff"},
+	}
+	got := item.enclosures()
+	if len(got) != len(want) {
+		t.Fatalf("enclosures = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("enclosure %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	if got := (RSSItem{}).enclosures(); len(got) != 0 {
+		t.Errorf("item without media has enclosures %+v", got)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/LegendLoreLori/radgregator/internal/migrate"
+)
+
+// schemaFiles is sql/schema built into the binary, sqlc reads the same files
+// so the queries and the migrations can't drift apart
+//
+//go:embed sql/schema/*.sql
+var schemaFiles embed.FS
+
+// migrationStatus is a migration as printed by migrate status
+type migrationStatus struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at"`
+}
+
+func loadMigrations() ([]migrate.Migration, error) {
+	return migrate.Load(schemaFiles, "sql/schema")
+}
+
+// checkSchema stops commands running against a database that's missing
+// migrations, their queries would fail part way through otherwise
+func checkSchema(s *state) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	pending, err := migrate.Pending(context.Background(), s.conn, migrations)
+	if err != nil {
+		return fmt.Errorf("unable to check the database schema: %w", err)
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("database schema is %d migrations behind, run `radgregate migrate up` first", len(pending))
+	}
+	return nil
+}
+
+func handlerMigrate(s *state, cmd command) error {
+	if len(cmd.args) < 2 {
+		return errors.New("missing positional argument [up|down|status|redo]")
+	}
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	switch cmd.args[1] {
+	case "up":
+		done, err := migrate.Up(ctx, s.conn, migrations)
+		for _, migration := range done {
+			fmt.Printf("applied %s\n", migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(done) == 0 {
+			println("database schema is up to date")
+		}
+		return nil
+	case "down":
+		migration, err := migrate.Down(ctx, s.conn, migrations)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("rolled back %s\n", migration.Name)
+		return nil
+	case "redo":
+		migration, err := migrate.Down(ctx, s.conn, migrations)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("rolled back %s\n", migration.Name)
+		// only reapply the one that was rolled back, not anything pending
+		// after it
+		last := slices.IndexFunc(migrations, func(m migrate.Migration) bool {
+			return m.Version == migration.Version
+		})
+		done, err := migrate.Up(ctx, s.conn, migrations[:last+1])
+		for _, migration := range done {
+			fmt.Printf("applied %s\n", migration.Name)
+		}
+		return err
+	case "status":
+		return printMigrationStatus(s, migrations)
+	}
+	return fmt.Errorf("unknown migrate command %q, expected up, down, status or redo", cmd.args[1])
+}
+
+func printMigrationStatus(s *state, migrations []migrate.Migration) error {
+	statuses, err := migrate.Statuses(context.Background(), s.conn, migrations)
+	if err != nil {
+		return err
+	}
+	if s.output != outputText {
+		records := make([]migrationStatus, 0, len(statuses))
+		for _, status := range statuses {
+			record := migrationStatus{
+				Version: status.Version,
+				Name:    status.Name,
+			}
+			if status.Applied() {
+				record.AppliedAt = &status.AppliedAt
+			}
+			records = append(records, record)
+		}
+		return printRecords(s.output, records)
+	}
+
+	for _, status := range statuses {
+		if status.Applied() {
+			fmt.Printf(" * %s - applied %s\n", status.Name, status.AppliedAt.Format(time.RFC1123))
+		} else {
+			fmt.Printf(" * %s - pending\n", status.Name)
+		}
+	}
+	return nil
+}
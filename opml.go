@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/LegendLoreLori/radgregator/internal/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type OPML struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    struct {
+		Title       string `xml:"title"`
+		DateCreated string `xml:"dateCreated,omitempty"`
+	} `xml:"head"`
+	Body struct {
+		Outline []OPMLOutline `xml:"outline"`
+	} `xml:"body"`
+}
+
+type OPMLOutline struct {
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr,omitempty"`
+	Type     string        `xml:"type,attr,omitempty"`
+	XMLUrl   string        `xml:"xmlUrl,attr,omitempty"`
+	HTMLUrl  string        `xml:"htmlUrl,attr,omitempty"`
+	Category string        `xml:"category,attr,omitempty"`
+	Outline  []OPMLOutline `xml:"outline"`
+}
+
+// opmlFeed is a subscription pulled out of an outline tree, tags holds the
+// outline's own categories plus the folders it was nested in
+type opmlFeed struct {
+	name string
+	url  string
+	tags []string
+}
+
+// categoryTags splits an opml category attribute, a comma separated list of
+// slash delimited paths, into tags
+func categoryTags(category string) []string {
+	var tags []string
+	for _, path := range strings.Split(category, ",") {
+		if tag := strings.Trim(strings.TrimSpace(path), "/"); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// flattenOutlines walks the outline tree collecting every outline with an
+// xmlUrl, outlines without one are treated as folders
+func flattenOutlines(outlines []OPMLOutline, folder string) []opmlFeed {
+	var feeds []opmlFeed
+	for _, outline := range outlines {
+		name := outline.Title
+		if name == "" {
+			name = outline.Text
+		}
+		if outline.XMLUrl == "" {
+			feeds = append(feeds, flattenOutlines(outline.Outline, folder+"/"+name)...)
+			continue
+		}
+
+		tags := categoryTags(outline.Category)
+		if folder != "" {
+			tags = append(tags, strings.Trim(folder, "/"))
+		}
+		if name == "" {
+			name = outline.XMLUrl
+		}
+		feeds = append(feeds, opmlFeed{
+			name: name,
+			url:  outline.XMLUrl,
+			tags: tags,
+		})
+		feeds = append(feeds, flattenOutlines(outline.Outline, folder)...)
+	}
+	return feeds
+}
+
+func handlerImportOPML(s *state, cmd command, user database.User) error {
+	if len(cmd.args) < 2 {
+		return errors.New("missing positional argument [FILE]")
+	}
+
+	data, err := os.ReadFile(cmd.args[1])
+	if err != nil {
+		return err
+	}
+	var doc OPML
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("unable to parse opml: %w", err)
+	}
+
+	feeds := flattenOutlines(doc.Body.Outline, "")
+	if len(feeds) == 0 {
+		return errors.New("no feeds found in opml")
+	}
+
+	failed := 0
+	for _, f := range feeds {
+		result, err := importFeed(s, user, f)
+		if err != nil {
+			failed++
+			fmt.Printf(" * %s - error: %v\n", f.url, err)
+			continue
+		}
+		fmt.Printf(" * %s - %s\n", f.url, result)
+	}
+
+	fmt.Printf("imported %d of %d feeds\n", len(feeds)-failed, len(feeds))
+	return nil
+}
+
+// importFeed creates the feed if nobody has added it yet, follows it and tags
+// the follow with the outline's categories, returning a short description of
+// what happened
+func importFeed(s *state, user database.User, f opmlFeed) (string, error) {
+	result := "followed"
+	feed, err := s.db.GetFeed(context.Background(), f.url)
+	if errors.Is(err, sql.ErrNoRows) {
+		feed, err = s.db.CreateFeed(context.Background(), database.CreateFeedParams{
+			ID:        uuid.New(),
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+			Name:      f.name,
+			Url:       f.url,
+			UserID:    user.ID,
+		})
+		if err != nil {
+			return "", err
+		}
+		log.Printf("feed created: %+v\n", feed)
+		result = "created and followed"
+	} else if err != nil {
+		return "", err
+	}
+
+	feedFollow, err := s.db.CreateFeedFollow(context.Background(), database.CreateFeedFollowParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		UserID:    user.ID,
+		FeedID:    feed.ID,
+	})
+	var sqlErr *pq.Error
+	if errors.As(err, &sqlErr) && sqlErr.Code == "23505" { // duplicate key entry
+		result = "already following"
+	} else if err != nil {
+		return "", err
+	} else {
+		filterFollowedFeed(context.Background(), s, user.ID, feed.ID)
+		log.Printf("feed_follow created: %+v\n", feedFollow)
+	}
+
+	for _, tag := range f.tags {
+		_, err := s.db.TagFeedFollow(context.Background(), database.TagFeedFollowParams{
+			Tag:    tag,
+			UserID: user.ID,
+			Url:    feed.Url,
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	if len(f.tags) > 0 {
+		result += fmt.Sprintf(", tagged %s", strings.Join(f.tags, ", "))
+	}
+	return result, nil
+}
+
+func handlerExportOPML(s *state, cmd command, user database.User) error {
+	following, err := s.db.GetFeedFollowsForUser(context.Background(), database.GetFeedFollowsForUserParams{
+		Name: user.Name,
+	})
+	if err != nil {
+		return err
+	}
+
+	var doc OPML
+	doc.Version = "2.0"
+	doc.Head.Title = fmt.Sprintf("%s's radgregator subscriptions", user.Name)
+	doc.Head.DateCreated = time.Now().Format(time.RFC1123Z)
+	for _, follow := range following {
+		categories := make([]string, 0, len(follow.Tags))
+		for _, tag := range follow.Tags {
+			categories = append(categories, "/"+tag)
+		}
+		doc.Body.Outline = append(doc.Body.Outline, OPMLOutline{
+			Text:     follow.FeedName,
+			Title:    follow.FeedName,
+			Type:     "rss",
+			XMLUrl:   follow.FeedUrl,
+			Category: strings.Join(categories, ","),
+		})
+	}
+
+	data, err := xml.MarshalIndent(doc, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	// the report goes to stderr so the opml can be piped when no file is given
+	var out io.Writer = os.Stdout
+	if len(cmd.args) >= 2 {
+		file, err := os.Create(cmd.args[1])
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+	if _, err := fmt.Fprintf(out, "%s%s\n", xml.Header, data); err != nil {
+		return err
+	}
+
+	for _, follow := range following {
+		fmt.Fprintf(os.Stderr, " * %s - exported\n", follow.FeedUrl)
+	}
+	fmt.Fprintf(os.Stderr, "exported %d feeds\n", len(following))
+	return nil
+}
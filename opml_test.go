@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/xml"
+	"slices"
+	"testing"
+)
+
+func TestCategoryTags(t *testing.T) {
+	tests := []struct {
+		category string
+		want     []string
+	}{
+		{"", nil},
+		{" , ", nil},
+		{"news", []string{"news"}},
+		{"/news", []string{"news"}},
+		{"/tech/go/", []string{"tech/go"}},
+		{"/news, /tech/go ,podcasts", []string{"news", "tech/go", "podcasts"}},
+		{"/", nil},
+	}
+
+	for _, tt := range tests {
+		if got := categoryTags(tt.category); !slices.Equal(got, tt.want) {
+			t.Errorf("categoryTags(%q) = %q, want %q", tt.category, got, tt.want)
+		}
+	}
+}
+
+const opmlDoc = `<?xml version="1.0" encoding="UTF-8"?>
+<opml version="2.0">
+	<head><title>subscriptions</title></head>
+	<body>
+		<outline text="Top" xmlUrl="https://example.com/top.xml"/>
+		<outline text="Tech">
+			<outline text="Go Blog" title="The Go Blog" xmlUrl="https://go.dev/blog/feed.atom" category="/lang"/>
+			<outline text="Deep">
+				<outline text="Nested" xmlUrl="https://example.com/nested.xml"/>
+			</outline>
+		</outline>
+		<outline text="" xmlUrl="https://example.com/untitled.xml" category="/a,/b/c"/>
+		<outline text="Parent" xmlUrl="https://example.com/parent.xml">
+			<outline text="Child" xmlUrl="https://example.com/child.xml"/>
+		</outline>
+		<outline text="Empty folder"/>
+	</body>
+</opml>`
+
+func TestFlattenOutlines(t *testing.T) {
+	var doc OPML
+	if err := xml.Unmarshal([]byte(opmlDoc), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []opmlFeed{
+		{"Top", "https://example.com/top.xml", nil},
+		{"The Go Blog", "https://go.dev/blog/feed.atom", []string{"lang", "Tech"}},
+		{"Nested", "https://example.com/nested.xml", []string{"Tech/Deep"}},
+		{"https://example.com/untitled.xml", "https://example.com/untitled.xml", []string{"a", "b/c"}},
+		{"Parent", "https://example.com/parent.xml", nil},
+		{"Child", "https://example.com/child.xml", nil},
+	}
+	got := flattenOutlines(doc.Body.Outline, "")
+	if len(got) != len(want) {
+		t.Fatalf("flattenOutlines = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i].name != want[i].name || got[i].url != want[i].url || !slices.Equal(got[i].tags, want[i].tags) {
+			t.Errorf("feed %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
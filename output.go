@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// outputFormat is set with the global --output option. json, csv and table
+// output all come from the api structs so the field names scripts see are the
+// same ones the api returns, they're part of the interface and don't change:
+//
+//	list:      id, created_at, updated_at, name, current
+//	feeds:     name, url, user_name
+//	following: user_name, feed_name, feed_id, feed_url, tags
+//	browse:    id, title, url, description, published_at, author, categories,
+//	           feed_name, read_at, highlighted
+//	migrate status: version, name, applied_at
+//
+// times are RFC 3339 and missing values are null in json and empty in csv and
+// table output, lists are json arrays and joined with ";" in csv. browse
+// writes the cursor for the next page to stderr as "next cursor: TOKEN"
+type outputFormat string
+
+const (
+	outputText  outputFormat = "text"
+	outputJSON  outputFormat = "json"
+	outputCSV   outputFormat = "csv"
+	outputTable outputFormat = "table"
+)
+
+// listedUser is a user as printed by list, current marks the logged in user
+type listedUser struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Name      string    `json:"name"`
+	Current   bool      `json:"current"`
+}
+
+// maxTableCell stops long descriptions from pushing every other column off
+// the screen, csv and json are never truncated
+const maxTableCell = 60
+
+func parseOutputFormat(value string) (outputFormat, error) {
+	switch format := outputFormat(strings.ToLower(value)); format {
+	case outputText, outputJSON, outputCSV, outputTable:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown output format %q, expected text, json, csv or table", value)
+}
+
+// extractOutputFlag pulls --output out of the arguments wherever it appears,
+// before or after the command name, so commands don't each have to define it
+func extractOutputFlag(args []string) (outputFormat, []string, error) {
+	format := outputText
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := strings.Cut(args[i], "=")
+		if name != "--output" && name != "-output" {
+			rest = append(rest, args[i])
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				return "", nil, errors.New("missing value for --output")
+			}
+			i++
+			value = args[i]
+		}
+		var err error
+		if format, err = parseOutputFormat(value); err != nil {
+			return "", nil, err
+		}
+	}
+	return format, rest, nil
+}
+
+// printRecords writes records as json, csv or an aligned table, text output
+// isn't handled here since each command prints its own
+func printRecords[T any](format outputFormat, records []T) error {
+	if records == nil {
+		records = []T{}
+	}
+	if format == outputJSON {
+		data, err := json.MarshalIndent(records, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\n", data)
+		return nil
+	}
+
+	columns := recordColumns(reflect.TypeFor[T]())
+	rows := make([][]string, 0, len(records))
+	for _, record := range records {
+		rows = append(rows, recordValues(reflect.ValueOf(record), format))
+	}
+
+	if format == outputCSV {
+		w := csv.NewWriter(os.Stdout)
+		w.Write(columns)
+		w.WriteAll(rows)
+		return w.Error()
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, strings.ToUpper(strings.Join(columns, "\t")))
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
+
+// recordColumns lists the json names of a struct's fields
+func recordColumns(t reflect.Type) []string {
+	var columns []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		columns = append(columns, name)
+	}
+	return columns
+}
+
+func recordValues(v reflect.Value, format outputFormat) []string {
+	var values []string
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		values = append(values, formatCell(v.Field(i).Interface(), format))
+	}
+	return values
+}
+
+func formatCell(value any, format outputFormat) string {
+	var cell string
+	switch value := value.(type) {
+	case time.Time:
+		cell = value.Format(time.RFC3339)
+	case *time.Time:
+		if value != nil {
+			cell = value.Format(time.RFC3339)
+		}
+	case []string:
+		if format == outputTable {
+			cell = strings.Join(value, ", ")
+		} else {
+			cell = strings.Join(value, ";")
+		}
+	default:
+		cell = fmt.Sprint(value)
+	}
+	if format != outputTable {
+		return cell
+	}
+
+	cell = strings.Join(strings.Fields(cell), " ")
+	if utf8.RuneCountInString(cell) > maxTableCell {
+		cell = string([]rune(cell)[:maxTableCell-1]) + "…"
+	}
+	return cell
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/LegendLoreLori/radgregator/internal/database"
+	"github.com/google/uuid"
+)
+
+// postCursor marks the last post of a page, it's handed out base64 encoded
+// so scripts can treat it as an opaque token. the sort it was made with is
+// kept in it since a cursor means nothing under a different order
+type postCursor struct {
+	Sort       string    `json:"s"`
+	Descending bool      `json:"d"`
+	Key        time.Time `json:"k"`
+	ID         uuid.UUID `json:"i"`
+}
+
+// postQuery is what browse, the api and the reader ask for, SortBy picks
+// which of the two posts queries it runs as. they take the same parameters
+// and select the same columns so the published ones are used for both
+type postQuery struct {
+	database.GetPostsForUserByPublishedParams
+	SortBy string
+}
+
+// getPostsForUser runs q against the query for its sort
+func getPostsForUser(ctx context.Context, db *database.Queries, q postQuery) ([]database.GetPostsForUserByPublishedRow, error) {
+	if q.SortBy != "fetched" {
+		return db.GetPostsForUserByPublished(ctx, q.GetPostsForUserByPublishedParams)
+	}
+	rows, err := db.GetPostsForUserByFetched(ctx, database.GetPostsForUserByFetchedParams(q.GetPostsForUserByPublishedParams))
+	if err != nil {
+		return nil, err
+	}
+	posts := make([]database.GetPostsForUserByPublishedRow, 0, len(rows))
+	for _, row := range rows {
+		posts = append(posts, database.GetPostsForUserByPublishedRow(row))
+	}
+	return posts, nil
+}
+
+// parsePostSort checks the sort and order options shared by browse and the
+// api
+func parsePostSort(sortBy, order string) (string, bool, error) {
+	if sortBy != "published" && sortBy != "fetched" {
+		return "", false, fmt.Errorf("unknown sort %q, expected published or fetched", sortBy)
+	}
+	if order != "asc" && order != "desc" {
+		return "", false, fmt.Errorf("unknown order %q, expected asc or desc", order)
+	}
+	return sortBy, order == "desc", nil
+}
+
+// applyCursor sets up params to continue after the post in token
+func applyCursor(params *postQuery, token string) error {
+	if token == "" {
+		return nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return errors.New("invalid cursor")
+	}
+	var cursor postCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return errors.New("invalid cursor")
+	}
+	if cursor.Sort != params.SortBy || cursor.Descending != params.Descending {
+		return errors.New("cursor was made with a different sort or order")
+	}
+
+	params.CursorKey = sql.NullTime{
+		Time:  cursor.Key,
+		Valid: true,
+	}
+	params.CursorID = uuid.NullUUID{
+		UUID:  cursor.ID,
+		Valid: true,
+	}
+	return nil
+}
+
+// nextCursor is the token for the page after posts, a short page is the last
+// one so it gets no token
+func nextCursor(params postQuery, posts []database.GetPostsForUserByPublishedRow) string {
+	if len(posts) == 0 || len(posts) < int(params.Limit) {
+		return ""
+	}
+	last := posts[len(posts)-1]
+	key := last.PublishedAt.Time
+	if params.SortBy == "fetched" {
+		key = last.CreatedAt
+	}
+	data, err := json.Marshal(postCursor{
+		Sort:       params.SortBy,
+		Descending: params.Descending,
+		Key:        key,
+		ID:         last.ID,
+	})
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/LegendLoreLori/radgregator/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	published := time.Date(2024, time.September, 3, 16, 5, 0, 0, time.UTC)
+	fetched := time.Date(2024, time.September, 4, 8, 0, 0, 123456000, time.UTC)
+	first := database.GetPostsForUserByPublishedRow{
+		ID:          uuid.New(),
+		PublishedAt: sql.NullTime{Time: published.Add(time.Hour), Valid: true},
+		CreatedAt:   fetched.Add(time.Hour),
+	}
+	last := database.GetPostsForUserByPublishedRow{
+		ID:          uuid.New(),
+		PublishedAt: sql.NullTime{Time: published, Valid: true},
+		CreatedAt:   fetched,
+	}
+
+	tests := []struct {
+		sortBy     string
+		descending bool
+		key        time.Time
+	}{
+		{"published", true, published},
+		{"published", false, published},
+		{"fetched", true, fetched},
+		{"fetched", false, fetched},
+	}
+
+	for _, tt := range tests {
+		params := postQuery{SortBy: tt.sortBy}
+		params.Descending = tt.descending
+		params.Limit = 2
+
+		token := nextCursor(params, []database.GetPostsForUserByPublishedRow{first, last})
+		if token == "" {
+			t.Errorf("%s desc=%t: full page has no cursor", tt.sortBy, tt.descending)
+			continue
+		}
+
+		next := postQuery{SortBy: tt.sortBy}
+		next.Descending = tt.descending
+		if err := applyCursor(&next, token); err != nil {
+			t.Errorf("%s desc=%t: applyCursor returned error: %v", tt.sortBy, tt.descending, err)
+			continue
+		}
+		if !next.CursorKey.Valid || !next.CursorKey.Time.Equal(tt.key) {
+			t.Errorf("%s desc=%t: cursor key = %v, want %s", tt.sortBy, tt.descending, next.CursorKey, tt.key)
+		}
+		if !next.CursorID.Valid || next.CursorID.UUID != last.ID {
+			t.Errorf("%s desc=%t: cursor id = %v, want %s", tt.sortBy, tt.descending, next.CursorID, last.ID)
+		}
+	}
+}
+
+func TestNextCursorLastPage(t *testing.T) {
+	params := postQuery{SortBy: "published"}
+	params.Limit = 2
+	posts := []database.GetPostsForUserByPublishedRow{{
+		ID:          uuid.New(),
+		PublishedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	}}
+
+	if token := nextCursor(params, nil); token != "" {
+		t.Errorf("empty page has cursor %q", token)
+	}
+	if token := nextCursor(params, posts); token != "" {
+		t.Errorf("short page has cursor %q", token)
+	}
+}
+
+func TestApplyCursorErrors(t *testing.T) {
+	params := postQuery{SortBy: "published"}
+	params.Descending = true
+	params.Limit = 1
+	token := nextCursor(params, []database.GetPostsForUserByPublishedRow{{
+		ID:          uuid.New(),
+		PublishedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	}})
+
+	tests := []struct {
+		name       string
+		sortBy     string
+		descending bool
+		token      string
+	}{
+		{"not base64", "published", true, "not a cursor!"},
+		{"not json", "published", true, base64.RawURLEncoding.EncodeToString([]byte("nope"))},
+		{"different sort", "fetched", true, token},
+		{"different order", "published", false, token},
+	}
+
+	for _, tt := range tests {
+		next := postQuery{SortBy: tt.sortBy}
+		next.Descending = tt.descending
+		if err := applyCursor(&next, tt.token); err == nil {
+			t.Errorf("%s: applyCursor succeeded, want an error", tt.name)
+		}
+		if next.CursorKey.Valid || next.CursorID.Valid {
+			t.Errorf("%s: cursor set despite the error", tt.name)
+		}
+	}
+
+	// no token is the first page
+	next := postQuery{SortBy: "published"}
+	if err := applyCursor(&next, ""); err != nil || next.CursorKey.Valid {
+		t.Errorf("empty token: err = %v, cursor key = %v", err, next.CursorKey)
+	}
+}
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"encoding/xml"
 	"errors"
 	"fmt"
@@ -10,49 +13,200 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/LegendLoreLori/radgregator/internal/database"
+	"github.com/LegendLoreLori/radgregator/internal/pubdate"
 	"github.com/google/uuid"
 	"github.com/lib/pq"
 )
 
 type RSSFeed struct {
 	Channel struct {
-		Title       string    `xml:"title"`
-		Link        string    `xml:"link"`
-		Description string    `xml:"description"`
-		Item        []RSSItem `xml:"item"`
+		Title         string    `xml:"title"`
+		Link          string    `xml:"link"`
+		Description   string    `xml:"description"`
+		PubDate       string    `xml:"pubDate"`
+		LastBuildDate string    `xml:"lastBuildDate"`
+		Item          []RSSItem `xml:"item"`
+
+		TTL             string `xml:"ttl"`
+		UpdatePeriod    string `xml:"http://purl.org/rss/1.0/modules/syndication/ updatePeriod"`
+		UpdateFrequency string `xml:"http://purl.org/rss/1.0/modules/syndication/ updateFrequency"`
 	} `xml:"channel"`
 }
 
 type RSSItem struct {
-	Title       string `xml:"title"`
-	Link        string `xml:"link"`
-	Description string `xml:"description"`
-	PubDate     string `xml:"pubDate"`
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	Description string   `xml:"description"`
+	PubDate     string   `xml:"pubDate"`
+	Content     string   `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	Creator     string   `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Author      string   `xml:"author"`
+	Category    []string `xml:"category"`
+	GUID        RSSGUID  `xml:"guid"`
+	Comments    string   `xml:"comments"`
+
+	Enclosure    []RSSEnclosure `xml:"enclosure"`
+	Duration     string         `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd duration"`
+	Image        ITunesImage    `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd image"`
+	MediaContent []MediaContent `xml:"http://search.yahoo.com/mrss/ content"`
+	MediaGroup   []MediaGroup   `xml:"http://search.yahoo.com/mrss/ group"`
+}
+
+// RSSGUID is an item's guid, isPermaLink defaults to true when it's missing
+type RSSGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink string `xml:"isPermaLink,attr"`
+}
+
+// author prefers dc:creator since <author> is meant to be an email address
+func (item RSSItem) author() string {
+	if creator := strings.TrimSpace(item.Creator); creator != "" {
+		return creator
+	}
+	return strings.TrimSpace(item.Author)
+}
+
+// contentHash identifies a version of an item so edits can be spotted, it has
+// to match the hash 016_posts_dedup_by_item_key.sql backfilled with
+func contentHash(title, description, content string) string {
+	sum := sha256.Sum256([]byte(title + "\n" + description + "\n" + content))
+	return hex.EncodeToString(sum[:])
+}
+
+// nullString is the sql.NullString for s, empty strings are NULL
+func nullString(s string) sql.NullString {
+	return sql.NullString{
+		String: s,
+		Valid:  s != "",
+	}
+}
+
+// maxFeedSize caps how much of a response body is read, feeds bigger than this
+// are almost certainly not feeds
+const maxFeedSize = 10 << 20
+
+// feedClient is shared by every aggregator worker, the transport limits how
+// many connections are opened to a single host so a pool of workers doesn't
+// hammer one publisher
+var feedClient = &http.Client{
+	Timeout: 30 * time.Second,
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   4,
+		MaxConnsPerHost:       4,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 15 * time.Second,
+	},
 }
 
-var commonDateLayouts = []string{time.RFC1123, time.RFC1123Z, time.RFC3339, time.RFC3339Nano, time.RFC822, time.RFC822Z, time.RFC850}
+// errNotModified is returned by fetchFeed when the server answers a
+// conditional request with 304, the feed is unchanged since the last fetch
+var errNotModified = errors.New("feed not modified")
 
-func fetchFeed(ctx context.Context, feedUrl string) (*RSSFeed, error) {
+// statusError is returned by fetchFeed for any non 2xx response, RetryAfter
+// is set when the server said how long to wait before trying again
+type statusError struct {
+	StatusCode int
+	RetryAfter time.Duration
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected response: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// fetchError wraps anything that went wrong downloading or parsing a feed,
+// only these count against the feed's health. database errors say nothing
+// about the feed and shouldn't push every feed into backoff during an outage
+type fetchError struct {
+	err error
+}
+
+func (e *fetchError) Error() string {
+	return e.err.Error()
+}
+
+func (e *fetchError) Unwrap() error {
+	return e.err
+}
+
+const (
+	backoffBase = 5 * time.Minute
+	backoffMax  = 24 * time.Hour
+)
+
+// backoff doubles the wait before the next attempt with every consecutive
+// failure, capped at backoffMax
+func backoff(failures int32) time.Duration {
+	delay := backoffBase
+	for i := int32(1); i < failures; i++ {
+		delay *= 2
+		if delay >= backoffMax {
+			return backoffMax
+		}
+	}
+	return delay
+}
+
+// fetchMeta holds the validators sent back by the server for a feed so the
+// next fetch can be made conditional, MaxAge is how long the server said the
+// response stays fresh for
+type fetchMeta struct {
+	ETag         string
+	LastModified string
+	MaxAge       time.Duration
+}
+
+// fetchFeed downloads and parses the feed at feedUrl, if meta is non nil its
+// validators are sent with the request and updated from the response
+func fetchFeed(ctx context.Context, feedUrl string, meta *fetchMeta) (*RSSFeed, error) {
 	req, err := http.NewRequestWithContext(ctx, "GET", feedUrl, nil)
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Set("User-Agent", "radgregator")
-	res, err := http.DefaultClient.Do(req)
+	req.Header.Set("Accept", "application/rss+xml, application/atom+xml, application/feed+json, application/xml;q=0.9, */*;q=0.8")
+	if meta != nil {
+		if meta.ETag != "" {
+			req.Header.Set("If-None-Match", meta.ETag)
+		}
+		if meta.LastModified != "" {
+			req.Header.Set("If-Modified-Since", meta.LastModified)
+		}
+	}
+	res, err := feedClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer res.Body.Close()
-	feedData, err := io.ReadAll(res.Body)
+	if meta != nil {
+		meta.MaxAge = maxAge(res.Header.Get("Cache-Control"))
+	}
+	if res.StatusCode == http.StatusNotModified {
+		return nil, errNotModified
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, &statusError{
+			StatusCode: res.StatusCode,
+			RetryAfter: retryAfter(res.Header.Get("Retry-After"), time.Now()),
+		}
+	}
+	if meta != nil {
+		meta.ETag = res.Header.Get("ETag")
+		meta.LastModified = res.Header.Get("Last-Modified")
+	}
+	feedData, err := io.ReadAll(io.LimitReader(res.Body, maxFeedSize))
 	if err != nil {
 		return nil, err
 	}
 
-	var feed RSSFeed
-	err = xml.Unmarshal(feedData, &feed)
+	feed, err := parseFeed(feedData)
 	if err != nil {
 		return nil, err
 	}
@@ -61,44 +215,165 @@ func fetchFeed(ctx context.Context, feedUrl string) (*RSSFeed, error) {
 	for i := 0; i < len(feed.Channel.Item); i++ {
 		feed.Channel.Item[i].Title = html.UnescapeString(feed.Channel.Item[i].Title)
 		feed.Channel.Item[i].Description = html.UnescapeString(feed.Channel.Item[i].Description)
+		feed.Channel.Item[i].Creator = html.UnescapeString(feed.Channel.Item[i].Creator)
+		feed.Channel.Item[i].Author = html.UnescapeString(feed.Channel.Item[i].Author)
 	}
 
-	return &feed, nil
+	return feed, nil
 }
 
-func scrapeFeeds(ctx context.Context, s *state) error {
-	feedDetails, err := s.db.GetNextFeedToFetch(ctx)
-	if err != nil {
-		return err
+// parseFeed sniffs the document and unmarshals it as either rss, atom or json
+// feed, anything that isn't rss is converted into an RSSFeed
+// utf8BOM is dropped from the front of feeds, some servers send one and the
+// json decoder won't skip it
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+func parseFeed(feedData []byte) (*RSSFeed, error) {
+	feedData = bytes.TrimPrefix(feedData, utf8BOM)
+	if trimmed := bytes.TrimSpace(feedData); len(trimmed) > 0 && trimmed[0] == '{' {
+		feed, err := parseJSONFeed(trimmed)
+		if err != nil {
+			return nil, err
+		}
+		return feed.toRSS(), nil
 	}
-	err = s.db.MarkFeedFetched(ctx, database.MarkFeedFetchedParams{
-		UpdatedAt: time.Now(),
-		ID:        feedDetails.ID,
-	})
+
+	root, err := rootElement(feedData)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	feed, err := fetchFeed(ctx, feedDetails.Url)
-	if err != nil {
-		return err
+	switch root {
+	case "rss":
+		var feed RSSFeed
+		if err := xml.Unmarshal(feedData, &feed); err != nil {
+			return nil, err
+		}
+		return &feed, nil
+	case "feed":
+		var feed AtomFeed
+		if err := xml.Unmarshal(feedData, &feed); err != nil {
+			return nil, err
+		}
+		return feed.toRSS(), nil
+	default:
+		return nil, fmt.Errorf("unsupported feed format: <%s>", root)
+	}
+}
+
+func rootElement(data []byte) (string, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", fmt.Errorf("unable to find root element: %w", err)
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name.Local, nil
+		}
 	}
+}
 
-	fmt.Printf("saving posts for %s...", feed.Channel.Title)
+// scrapeFeeds runs a pool of workers which each claim batches of feeds that
+// haven't been fetched since the cycle started, SKIP LOCKED keeps workers from
+// claiming the same feed so the cycle finishes once every batch is drained.
+// Cancelling ctx stops workers picking up new feeds, feeds already being
+// fetched are allowed to finish saving their posts
+func scrapeFeeds(ctx context.Context, s *state, workers, batchSize int, sched fetchSchedule) {
+	cycleStart := time.Now()
+	sched.start = cycleStart
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				feeds, err := s.db.ClaimFeedsToFetch(ctx, database.ClaimFeedsToFetchParams{
+					UpdatedAt: time.Now(),
+					LastFetchedAt: sql.NullTime{
+						Time:  cycleStart,
+						Valid: true,
+					},
+					Limit: int32(batchSize),
+				})
+				if err != nil {
+					if ctx.Err() == nil {
+						log.Printf("error claiming feeds: %v", err)
+					}
+					return
+				}
+				if len(feeds) == 0 {
+					return
+				}
+				for _, feed := range feeds {
+					if ctx.Err() != nil {
+						return
+					}
+					if err := scrapeFeed(ctx, s, feed, sched); err != nil {
+						if ctx.Err() != nil {
+							// interrupted mid fetch, not the feed's fault
+							return
+						}
+						fmt.Printf("error scraping %s: %v\n", feed.Url, err)
+						log.Printf("error scraping %s: %v", feed.Url, err)
+						var fetchErr *fetchError
+						if !errors.As(err, &fetchErr) {
+							continue
+						}
+						if err := markFeedFailed(ctx, s, feed, fetchErr.err); err != nil {
+							log.Printf("error recording failure for %s: %v", feed.Url, err)
+						}
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func scrapeFeed(ctx context.Context, s *state, feedDetails database.Feed, sched fetchSchedule) error {
+	meta := fetchMeta{
+		ETag:         feedDetails.Etag.String,
+		LastModified: feedDetails.LastModified.String,
+	}
+	feed, err := fetchFeed(ctx, feedDetails.Url, &meta)
+	// once the feed has been downloaded its posts are saved even if a
+	// shutdown has been requested, rather than abandoning inserts half way
+	ctx = context.WithoutCancel(ctx)
+	if errors.Is(err, errNotModified) {
+		// a 304 has no body, the hint from the last full fetch still stands
+		publisher := time.Duration(feedDetails.PublisherIntervalSeconds.Int32) * time.Second
+		next := sched.nextFetch(ctx, s, feedDetails, max(publisher, meta.MaxAge))
+		return markFeedFetched(ctx, s, feedDetails.ID, meta, http.StatusNotModified, publisher, next)
+	} else if err != nil {
+		return &fetchError{err: err}
+	}
+
+	// items without a usable date fall back to the feed's own date, feeds
+	// that don't have one either fall back to when they were fetched
+	fetchedAt := time.Now()
+	feedDate := feed.Channel.LastBuildDate
+	if feedDate == "" {
+		feedDate = feed.Channel.PubDate
+	}
+
+	saved, updated := 0, 0
+	shared := sharedItemKeys(feed.Channel.Item)
+	var newPosts []uuid.UUID
+	rules := loadFilterRules(ctx, s, feedDetails.ID)
 	for _, post := range feed.Channel.Item {
-		pubDate := sql.NullTime{}
 		title := sql.NullString{}
 		description := sql.NullString{}
 
-		for _, format := range commonDateLayouts {
-			t, err := time.Parse(format, post.PubDate)
-			if err != nil {
-				continue
-			}
-			pubDate = sql.NullTime{
-				Time:  t,
-				Valid: true,
-			}
+		published, source := pubdate.ParseWithFallback(post.PubDate, feedDate, fetchedAt)
+		if source == pubdate.SourceFeed || source == pubdate.SourceFetched {
+			log.Printf("unparseable date %q in %s, using %s date", post.PubDate, feedDetails.Url, source)
+		}
+		// published_at has no time zone so postgres would drop the offset,
+		// everything in it is stored as utc
+		pubDate := sql.NullTime{
+			Time:  published.UTC(),
+			Valid: true,
 		}
 		if len(post.Title) != 0 {
 			title = sql.NullString{
@@ -107,13 +382,36 @@ func scrapeFeeds(ctx context.Context, s *state) error {
 			}
 		}
 		if len(post.Description) != 0 {
-			title = sql.NullString{
+			description = sql.NullString{
 				String: post.Description,
 				Valid:  true,
 			}
 		}
 
-		_, err = s.db.CreatePost(ctx, database.CreatePostParams{
+		var permalink sql.NullBool
+		guid := strings.TrimSpace(post.GUID.Value)
+		if guid != "" {
+			permalink = sql.NullBool{
+				Bool:  !strings.EqualFold(strings.TrimSpace(post.GUID.IsPermaLink), "false"),
+				Valid: true,
+			}
+		}
+		itemKey := post.itemKey()
+		if guid != "" && guid != post.Link {
+			// the post may have been saved before guids were, keyed on its link
+			_, err := s.db.AdoptLegacyPost(ctx, database.AdoptLegacyPostParams{
+				Guid:            guid,
+				GuidIsPermalink: permalink,
+				FeedID:          feedDetails.ID,
+				Url:             post.Link,
+			})
+			if err != nil {
+				log.Printf("unable to rekey %s on its guid: %v", post.Link, err)
+			}
+		}
+		hash := contentHash(post.Title, post.Description, post.Content)
+
+		created, err := s.db.CreatePost(ctx, database.CreatePostParams{
 			ID:          uuid.New(),
 			CreatedAt:   time.Now(),
 			UpdatedAt:   time.Now(),
@@ -122,15 +420,213 @@ func scrapeFeeds(ctx context.Context, s *state) error {
 			Description: description,
 			PublishedAt: pubDate,
 			FeedID:      feedDetails.ID,
+			PublishedAtSource: sql.NullString{
+				String: string(source),
+				Valid:  true,
+			},
+			Content:         nullString(post.Content),
+			Author:          nullString(post.author()),
+			Guid:            nullString(guid),
+			GuidIsPermalink: permalink,
+			CommentsUrl:     nullString(strings.TrimSpace(post.Comments)),
+			ItemKey:         itemKey,
+			ContentHash:     nullString(hash),
+			ImageUrl:        nullString(strings.TrimSpace(post.Image.Href)),
 		})
 		var sqlErr *pq.Error
 		if errors.As(err, &sqlErr) {
-			if sqlErr.Code == "23505" { // duplicate key entry
+			if sqlErr.Code == "23505" { // duplicate key entry, check if the item was edited
+				if shared[itemKey] {
+					// items sharing a key would overwrite each other and
+					// record a revision on every fetch
+					continue
+				}
+				postID, err := s.db.UpdatePost(ctx, database.UpdatePostParams{
+					UpdatedAt:   time.Now(),
+					Title:       title,
+					Url:         post.Link,
+					Description: description,
+					Content:     nullString(post.Content),
+					Author:      nullString(post.author()),
+					CommentsUrl: nullString(strings.TrimSpace(post.Comments)),
+					ImageUrl:    nullString(strings.TrimSpace(post.Image.Href)),
+					ContentHash: nullString(hash),
+					FeedID:      feedDetails.ID,
+					ItemKey:     itemKey,
+					RevisionID:  uuid.New(),
+				})
+				if errors.Is(err, sql.ErrNoRows) {
+					// unchanged since it was last saved
+					continue
+				} else if err != nil {
+					log.Printf("unable to update %s: %v", post.Link, err)
+					continue
+				}
+				savePostDetails(ctx, s, postID, post, true)
+				applyFilterRules(ctx, s, rules, postID, post, true)
+				updated++
 				continue
 			}
 			log.Print(err)
+			continue
+		} else if err != nil {
+			return err
+		}
+		savePostDetails(ctx, s, created.ID, post, false)
+		applyFilterRules(ctx, s, rules, created.ID, post, false)
+		saved++
+		newPosts = append(newPosts, created.ID)
+	}
+	queueNotifications(ctx, s, newPosts)
+	fmt.Printf("saved %d new posts for %s\n", saved, feed.Channel.Title)
+	if updated > 0 {
+		fmt.Printf("updated %d edited posts for %s\n", updated, feed.Channel.Title)
+	}
+	publisher := feed.updateHint()
+	next := sched.nextFetch(ctx, s, feedDetails, max(publisher, meta.MaxAge))
+	return markFeedFetched(ctx, s, feedDetails.ID, meta, http.StatusOK, publisher, next)
+}
+
+// markFeedFetched clears a feed's failures and records its validators, next
+// is when it's due again and publisher is the interval the feed asked for
+// itemKey is what an item is deduplicated on within its feed, the guid or the
+// link when there's no guid
+func (item RSSItem) itemKey() string {
+	if guid := strings.TrimSpace(item.GUID.Value); guid != "" {
+		return guid
+	}
+	return item.Link
+}
+
+// sharedItemKeys finds the keys used by more than one item in a fetch, some
+// feeds reuse a guid for every item
+func sharedItemKeys(items []RSSItem) map[string]bool {
+	seen := make(map[string]bool, len(items))
+	shared := make(map[string]bool)
+	for _, item := range items {
+		key := item.itemKey()
+		if seen[key] {
+			shared[key] = true
+		}
+		seen[key] = true
+	}
+	return shared
+}
+
+// savePostDetails stores an item's categories and enclosures, edited posts
+// also lose the ones the item no longer has
+func savePostDetails(ctx context.Context, s *state, postID uuid.UUID, item RSSItem, edited bool) {
+	// empty rather than nil, a nil array is NULL and would match nothing
+	categories := []string{}
+	for _, category := range item.Category {
+		category = strings.TrimSpace(category)
+		if category == "" {
+			continue
+		}
+		categories = append(categories, category)
+		err := s.db.CreatePostCategory(ctx, database.CreatePostCategoryParams{
+			PostID:   postID,
+			Category: category,
+		})
+		if err != nil {
+			log.Printf("unable to save category %q for %s: %v", category, item.Link, err)
 		}
 	}
-	println("done")
-	return nil
+
+	enclosures := item.enclosures()
+	urls := make([]string, 0, len(enclosures))
+	for _, e := range enclosures {
+		urls = append(urls, e.url)
+		err := s.db.CreatePostEnclosure(ctx, database.CreatePostEnclosureParams{
+			ID:       uuid.New(),
+			PostID:   postID,
+			Url:      e.url,
+			MimeType: nullString(e.mimeType),
+			Length: sql.NullInt64{
+				Int64: e.length,
+				Valid: e.length > 0,
+			},
+			DurationSeconds: sql.NullInt32{
+				Int32: int32(e.duration),
+				Valid: e.duration > 0,
+			},
+			Checksum: nullString(e.checksum),
+		})
+		if err != nil {
+			log.Printf("unable to save enclosure %s for %s: %v", e.url, item.Link, err)
+		}
+	}
+
+	if !edited {
+		return
+	}
+	err := s.db.DeleteStalePostCategories(ctx, database.DeleteStalePostCategoriesParams{
+		PostID:     postID,
+		Categories: categories,
+	})
+	if err != nil {
+		log.Printf("unable to remove old categories for %s: %v", item.Link, err)
+	}
+	err = s.db.DeleteStalePostEnclosures(ctx, database.DeleteStalePostEnclosuresParams{
+		PostID: postID,
+		Urls:   urls,
+	})
+	if err != nil {
+		log.Printf("unable to remove old enclosures for %s: %v", item.Link, err)
+	}
+}
+
+func markFeedFetched(ctx context.Context, s *state, feedID uuid.UUID, meta fetchMeta, status int, publisher time.Duration, next sql.NullTime) error {
+	return s.db.MarkFeedFetched(ctx, database.MarkFeedFetchedParams{
+		UpdatedAt: time.Now(),
+		Etag: sql.NullString{
+			String: meta.ETag,
+			Valid:  meta.ETag != "",
+		},
+		LastModified: sql.NullString{
+			String: meta.LastModified,
+			Valid:  meta.LastModified != "",
+		},
+		LastStatus: sql.NullInt32{
+			Int32: int32(status),
+			Valid: true,
+		},
+		NextFetchAt: next,
+		PublisherIntervalSeconds: sql.NullInt32{
+			Int32: int32(publisher / time.Second),
+			Valid: publisher > 0,
+		},
+		ID: feedID,
+	})
+}
+
+// markFeedFailed records why a fetch failed and pushes the feed's next
+// eligible fetch back, the http status is only known for statusErrors. a
+// Retry-After longer than the backoff is respected
+func markFeedFailed(ctx context.Context, s *state, feed database.Feed, fetchErr error) error {
+	status := sql.NullInt32{}
+	delay := backoff(feed.FailureCount + 1)
+	var statusErr *statusError
+	if errors.As(fetchErr, &statusErr) {
+		status = sql.NullInt32{
+			Int32: int32(statusErr.StatusCode),
+			Valid: true,
+		}
+		delay = max(delay, min(statusErr.RetryAfter, backoffMax))
+	}
+
+	now := time.Now()
+	return s.db.MarkFeedFailed(ctx, database.MarkFeedFailedParams{
+		UpdatedAt: now,
+		LastError: sql.NullString{
+			String: fetchErr.Error(),
+			Valid:  true,
+		},
+		LastStatus: status,
+		NextFetchAt: sql.NullTime{
+			Time:  now.Add(delay),
+			Valid: true,
+		},
+		ID: feed.ID,
+	})
 }
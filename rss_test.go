@@ -0,0 +1,52 @@
+package main
+
+import "testing"
+
+func TestParseFeed(t *testing.T) {
+	const bom = "\xef\xbb\xbf"
+	const rss = `<?xml version="1.0"?><rss version="2.0"><channel><title>rss</title></channel></rss>`
+	const atom = `<?xml version="1.0"?><feed xmlns="http://www.w3.org/2005/Atom"><title>atom</title></feed>`
+	const json = `{"version": "https://jsonfeed.org/version/1.1", "title": "json", "items": []}`
+
+	tests := []struct {
+		name  string
+		data  string
+		title string
+	}{
+		{"rss", rss, "rss"},
+		{"atom", atom, "atom"},
+		{"json", json, "json"},
+		{"json with leading whitespace", "\n\t " + json, "json"},
+		{"rss with a bom", bom + rss, "rss"},
+		{"atom with a bom", bom + atom, "atom"},
+		{"json with a bom", bom + json, "json"},
+		{"json with a bom and whitespace", bom + "\r\n" + json, "json"},
+		{"rss without a declaration", `<rss><channel><title>rss</title></channel></rss>`, "rss"},
+	}
+
+	for _, tt := range tests {
+		feed, err := parseFeed([]byte(tt.data))
+		if err != nil {
+			t.Errorf("%s: parseFeed returned error: %v", tt.name, err)
+			continue
+		}
+		if feed.Channel.Title != tt.title {
+			t.Errorf("%s: title = %q, want %q", tt.name, feed.Channel.Title, tt.title)
+		}
+	}
+}
+
+func TestParseFeedUnsupported(t *testing.T) {
+	for _, data := range []string{
+		"",
+		"   ",
+		"not a feed",
+		`<html><head><title>a page</title></head></html>`,
+		`{"version": "1.0", "title": "not a json feed"}`,
+		`{"version": "https://jsonfeed.org/version/1.1"`,
+	} {
+		if feed, err := parseFeed([]byte(data)); err == nil {
+			t.Errorf("parseFeed(%q) = %+v, want an error", data, feed)
+		}
+	}
+}
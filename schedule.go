@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LegendLoreLori/radgregator/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	// adaptive intervals stay between these so a burst of posts doesn't have
+	// a feed fetched every few seconds and a quiet feed is still checked daily
+	adaptiveMin = 15 * time.Minute
+	adaptiveMax = backoffMax
+
+	// minRefreshInterval is the shortest interval set-interval accepts, agg
+	// doesn't look for due feeds more often than this
+	minRefreshInterval = time.Minute
+)
+
+// fetchSchedule decides when a feed is next due. interval is agg's default
+// and adaptive turns on adaptive scheduling for every feed, start is when the
+// cycle began so feeds on the default interval line up with agg's ticks
+type fetchSchedule struct {
+	start    time.Time
+	interval time.Duration
+	adaptive bool
+}
+
+// nextFetch works out when feed should be fetched again. an interval set with
+// set-interval wins over adaptive scheduling, which wins over agg's default,
+// and none of them go below what the publisher asked for in the feed or the
+// response headers. a zero time means the feed is due every cycle
+func (sched fetchSchedule) nextFetch(ctx context.Context, s *state, feed database.Feed, hint time.Duration) sql.NullTime {
+	interval := sched.interval
+	if feed.RefreshIntervalSeconds.Valid {
+		interval = time.Duration(feed.RefreshIntervalSeconds.Int32) * time.Second
+	} else if feed.Adaptive || sched.adaptive {
+		if estimate, ok := postingInterval(ctx, s, feed.ID); ok {
+			interval = estimate
+		}
+	}
+	if hint > interval {
+		interval = min(hint, backoffMax)
+	}
+	if interval <= 0 {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{
+		Time:  sched.start.Add(interval),
+		Valid: true,
+	}
+}
+
+// postingInterval estimates how often a feed should be fetched from the gaps
+// between its recent posts, checking twice per average gap means a new post
+// waits half a gap on average before it's picked up
+func postingInterval(ctx context.Context, s *state, feedID uuid.UUID) (time.Duration, bool) {
+	rate, err := s.db.GetFeedPostingRate(ctx, feedID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false
+	} else if err != nil {
+		log.Printf("error estimating posting rate for %s: %v", feedID, err)
+		return 0, false
+	}
+	gap := rate.Newest.Sub(rate.Oldest) / time.Duration(rate.Posts-1)
+	return min(max(gap/2, adaptiveMin), adaptiveMax), true
+}
+
+// updateHint is the shortest interval the feed asks to be fetched at, from
+// rss <ttl> in minutes or the syndication module's updatePeriod divided by
+// updateFrequency. zero means the feed doesn't say
+func (feed *RSSFeed) updateHint() time.Duration {
+	var hint time.Duration
+	if ttl, err := strconv.Atoi(strings.TrimSpace(feed.Channel.TTL)); err == nil && ttl > 0 {
+		hint = time.Duration(ttl) * time.Minute
+	}
+
+	var period time.Duration
+	switch strings.ToLower(strings.TrimSpace(feed.Channel.UpdatePeriod)) {
+	case "hourly":
+		period = time.Hour
+	case "daily":
+		period = 24 * time.Hour
+	case "weekly":
+		period = 7 * 24 * time.Hour
+	case "monthly":
+		period = 30 * 24 * time.Hour
+	case "yearly":
+		period = 365 * 24 * time.Hour
+	}
+	if period > 0 {
+		frequency, err := strconv.Atoi(strings.TrimSpace(feed.Channel.UpdateFrequency))
+		if err != nil || frequency < 1 {
+			frequency = 1
+		}
+		hint = max(hint, period/time.Duration(frequency))
+	}
+	return hint
+}
+
+// maxAge reads max-age out of a Cache-Control header, no-store and no-cache
+// responses aren't fresh at all
+func maxAge(cacheControl string) time.Duration {
+	var age time.Duration
+	for _, directive := range strings.Split(cacheControl, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-store", "no-cache":
+			return 0
+		case "max-age":
+			seconds, err := strconv.Atoi(strings.Trim(value, `"`))
+			if err == nil && seconds > 0 {
+				age = time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	return age
+}
+
+// retryAfter reads a Retry-After header, which is either a number of seconds
+// or an http date
+func retryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0)
+	}
+	return 0
+}
+
+func formatInterval(feed database.Feed) string {
+	switch {
+	case feed.RefreshIntervalSeconds.Valid:
+		return (time.Duration(feed.RefreshIntervalSeconds.Int32) * time.Second).String()
+	case feed.Adaptive:
+		return "adaptive"
+	}
+	return "default"
+}
+
+func handlerSetInterval(s *state, cmd command) error {
+	if len(cmd.args) < 3 {
+		return errors.New("missing positional arguments [URL] [DURATION|adaptive|default]")
+	}
+	feedUrl, value := cmd.args[1], cmd.args[2]
+
+	params := database.SetFeedRefreshIntervalParams{
+		UpdatedAt: time.Now(),
+		Url:       feedUrl,
+	}
+	switch value {
+	case "default":
+	case "adaptive":
+		params.Adaptive = true
+	default:
+		interval, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid interval %q, expected a duration, adaptive or default", value)
+		}
+		if interval < minRefreshInterval || interval > backoffMax {
+			return fmt.Errorf("interval must be between %s and %s", minRefreshInterval, backoffMax)
+		}
+		params.RefreshIntervalSeconds = sql.NullInt32{
+			Int32: int32(interval / time.Second),
+			Valid: true,
+		}
+	}
+
+	updated, err := s.db.SetFeedRefreshInterval(context.Background(), params)
+	if err != nil {
+		return err
+	} else if updated == 0 {
+		return fmt.Errorf("no feed found for %q", feedUrl)
+	}
+
+	switch value {
+	case "default":
+		fmt.Printf("%s will be fetched on agg's interval\n", feedUrl)
+	case "adaptive":
+		fmt.Printf("%s will be fetched as often as it posts\n", feedUrl)
+	default:
+		fmt.Printf("%s will be fetched every %s\n", feedUrl, value)
+	}
+	return nil
+}
@@ -20,21 +20,51 @@ INNER JOIN feeds
 ON i_feed_follow.feed_id = feeds.id;
 
 -- name: GetFeedFollowsForUser :many
-SELECT users.name as user_name, feeds.name as feed_name, feed_follows.feed_id
+SELECT users.name as user_name, feeds.name as feed_name, feed_follows.feed_id,
+feeds.url as feed_url,
+ARRAY(
+	SELECT feed_follow_tags.tag
+	FROM feed_follow_tags
+	WHERE feed_follow_tags.feed_follow_id = feed_follows.id
+	ORDER BY feed_follow_tags.tag
+)::text[] as tags
 FROM feed_follows
 INNER JOIN users
 ON feed_follows.user_id = users.id
 INNER JOIN feeds
 ON feed_follows.feed_id = feeds.id
-WHERE users.name = $1;
+WHERE users.name = sqlc.arg(name)
+AND (sqlc.narg(tag)::text IS NULL OR EXISTS (
+	SELECT 1 FROM feed_follow_tags
+	WHERE feed_follow_tags.feed_follow_id = feed_follows.id
+	AND feed_follow_tags.tag = sqlc.narg(tag)
+));
 
 -- name: DeleteFeedFollow :one
-WITH feed_id AS (
+DELETE FROM feed_follows
+WHERE feed_follows.user_id = $1
+AND feed_follows.feed_id = (
 	SELECT feeds.id
 	FROM feeds
 	WHERE url = $2
 )
-DELETE FROM feed_follows 
-WHERE feed_follows.user_id = $1
-AND feed_id = feed_id
 RETURNING *;
+
+-- name: TagFeedFollow :execrows
+INSERT INTO feed_follow_tags (feed_follow_id, tag)
+SELECT feed_follows.id, sqlc.arg(tag)
+FROM feed_follows
+INNER JOIN feeds
+ON feed_follows.feed_id = feeds.id
+WHERE feed_follows.user_id = sqlc.arg(user_id)
+AND feeds.url = sqlc.arg(url)
+ON CONFLICT (feed_follow_id, tag) DO NOTHING;
+
+-- name: UntagFeedFollow :execrows
+DELETE FROM feed_follow_tags
+USING feed_follows, feeds
+WHERE feed_follow_tags.feed_follow_id = feed_follows.id
+AND feed_follows.feed_id = feeds.id
+AND feed_follows.user_id = $1
+AND feeds.url = $2
+AND feed_follow_tags.tag = $3;
@@ -30,10 +30,53 @@ RETURNING *;
 
 -- name: MarkFeedFetched :exec
 UPDATE feeds
-SET updated_at = $1, last_fetched_at = $1
-WHERE id = $2;
+SET updated_at = $1, last_fetched_at = $1, etag = $2, last_modified = $3,
+last_status = $4, last_error = NULL, failure_count = 0, next_fetch_at = $5,
+publisher_interval_seconds = $6
+WHERE id = $7;
+
+-- name: MarkFeedFailed :exec
+UPDATE feeds
+SET updated_at = $1, last_error = $2, last_status = $3,
+failure_count = failure_count + 1, next_fetch_at = $4
+WHERE id = $5;
 
--- name: GetNextFeedToFetch :one
+-- name: GetUnhealthyFeeds :many
 SELECT * FROM feeds
-ORDER BY last_fetched_at ASC NULLS FIRST
-LIMIT 1;
+WHERE failure_count > 0
+ORDER BY failure_count DESC, name;
+
+-- name: ClaimFeedsToFetch :many
+UPDATE feeds
+SET updated_at = $1, last_fetched_at = $1
+WHERE id IN (
+	SELECT stale.id FROM feeds AS stale
+	WHERE (stale.last_fetched_at IS NULL OR stale.last_fetched_at < $2)
+	AND (stale.next_fetch_at IS NULL OR stale.next_fetch_at <= $1)
+	ORDER BY stale.last_fetched_at ASC NULLS FIRST
+	LIMIT $3
+	FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: SetFeedRefreshInterval :execrows
+UPDATE feeds
+SET updated_at = $1, refresh_interval_seconds = $2, adaptive = $3
+WHERE url = $4;
+
+-- name: GetFeedPostingRate :one
+-- looks at the feed's last 20 dated posts, guessed dates are left out since
+-- they bunch up around fetch times. feeds with fewer than two have no rate and
+-- return no row
+SELECT count(*)::int AS posts,
+min(recent.published_at)::timestamp AS oldest,
+max(recent.published_at)::timestamp AS newest
+FROM (
+	SELECT published_at FROM posts
+	WHERE feed_id = $1
+	AND published_at IS NOT NULL
+	AND (published_at_source IS NULL OR published_at_source NOT IN ('feed', 'fetched'))
+	ORDER BY published_at DESC
+	LIMIT 20
+) AS recent
+HAVING count(*) >= 2;
@@ -0,0 +1,72 @@
+-- name: CreateFilterRule :one
+INSERT INTO filter_rules (id, created_at, user_id, mode, field, match_type, pattern, action, feed_id)
+VALUES (
+	$1,
+	$2,
+	$3,
+	$4,
+	$5,
+	$6,
+	$7,
+	$8,
+	$9
+)
+RETURNING *;
+
+-- name: GetFilterRulesForUser :many
+SELECT filter_rules.*, feeds.url AS feed_url
+FROM filter_rules
+LEFT JOIN feeds
+ON filter_rules.feed_id = feeds.id
+WHERE filter_rules.user_id = $1
+ORDER BY filter_rules.created_at;
+
+-- name: DeleteFilterRule :execrows
+DELETE FROM filter_rules
+WHERE user_id = $1 AND id = $2;
+
+-- name: GetFilterRulesForFeed :many
+-- every rule that applies to new posts in a feed, from each user following it
+SELECT filter_rules.*
+FROM filter_rules
+INNER JOIN feed_follows
+ON filter_rules.user_id = feed_follows.user_id
+WHERE feed_follows.feed_id = sqlc.arg(feed_id)
+AND (filter_rules.feed_id IS NULL OR filter_rules.feed_id = sqlc.arg(feed_id));
+
+-- name: CreateFilterMatch :execrows
+INSERT INTO filter_matches (rule_id, post_id)
+VALUES (
+	$1,
+	$2
+)
+ON CONFLICT (rule_id, post_id) DO NOTHING;
+
+-- name: DeleteFilterMatch :exec
+DELETE FROM filter_matches
+WHERE rule_id = $1 AND post_id = $2;
+
+-- name: GetFilterRulesForUserFeed :many
+-- the rules a user has that apply to a feed, for running them over the posts
+-- it already has when the user follows it
+SELECT * FROM filter_rules
+WHERE user_id = sqlc.arg(user_id)
+AND (feed_id IS NULL OR feed_id = sqlc.arg(feed_id));
+
+-- name: GetPostsToFilter :many
+-- a batch of the posts already stored for the feeds a user follows, walked in
+-- id order so new rules can be run over them without loading them all at once
+SELECT posts.id, posts.title, posts.description, posts.author,
+ARRAY(
+	SELECT post_categories.category
+	FROM post_categories
+	WHERE post_categories.post_id = posts.id
+)::text[] AS categories
+FROM posts
+INNER JOIN feed_follows
+ON posts.feed_id = feed_follows.feed_id
+WHERE feed_follows.user_id = sqlc.arg(user_id)
+AND (sqlc.narg(feed_id)::uuid IS NULL OR posts.feed_id = sqlc.narg(feed_id))
+AND posts.id > sqlc.arg(after)::uuid
+ORDER BY posts.id
+LIMIT sqlc.arg('limit');
@@ -0,0 +1,113 @@
+-- name: CreateNotificationTarget :one
+INSERT INTO notification_targets (id, created_at, updated_at, user_id, name, kind, url, email_from, email_to, feed_id, tag)
+VALUES (
+	$1,
+	$2,
+	$3,
+	$4,
+	$5,
+	$6,
+	$7,
+	$8,
+	$9,
+	$10,
+	$11
+)
+RETURNING *;
+
+-- name: DeleteNotificationTarget :execrows
+DELETE FROM notification_targets
+WHERE user_id = $1 AND name = $2;
+
+-- name: GetNotificationTargetsForUser :many
+SELECT notification_targets.*, feeds.url AS feed_url
+FROM notification_targets
+LEFT JOIN feeds
+ON notification_targets.feed_id = feeds.id
+WHERE notification_targets.user_id = $1
+ORDER BY notification_targets.name;
+
+-- name: GetNotificationTarget :one
+SELECT * FROM notification_targets
+WHERE id = $1;
+
+-- name: QueuePostNotifications :execrows
+-- queues the new posts for every target watching their feed, either directly
+-- or through a tag on the target owner's follow. posts the target's owner has
+-- a hide rule for are left out
+INSERT INTO notification_deliveries (target_id, post_id, created_at, next_attempt_at)
+SELECT notification_targets.id, posts.id, sqlc.arg(created_at), sqlc.arg(created_at)
+FROM posts
+INNER JOIN notification_targets
+ON notification_targets.feed_id = posts.feed_id
+OR EXISTS (
+	SELECT 1 FROM feed_follows
+	INNER JOIN feed_follow_tags
+	ON feed_follow_tags.feed_follow_id = feed_follows.id
+	WHERE feed_follows.user_id = notification_targets.user_id
+	AND feed_follows.feed_id = posts.feed_id
+	AND feed_follow_tags.tag = notification_targets.tag
+)
+WHERE posts.id = ANY(sqlc.arg(post_ids)::uuid[])
+AND NOT EXISTS (
+	SELECT 1 FROM filter_matches
+	INNER JOIN filter_rules
+	ON filter_matches.rule_id = filter_rules.id
+	WHERE filter_matches.post_id = posts.id
+	AND filter_rules.user_id = notification_targets.user_id
+	AND filter_rules.action = 'hide'
+)
+ON CONFLICT (target_id, post_id) DO NOTHING;
+
+-- name: ClaimDueDeliveries :many
+-- pushes next_attempt_at out by the lease so another agg process won't pick
+-- the same deliveries up while these are being sent
+UPDATE notification_deliveries
+SET next_attempt_at = sqlc.arg(lease_until)
+WHERE (target_id, post_id) IN (
+	SELECT due.target_id, due.post_id FROM notification_deliveries AS due
+	WHERE due.status = 'pending'
+	AND due.next_attempt_at <= sqlc.arg(now)
+	ORDER BY due.created_at
+	LIMIT sqlc.arg('limit')
+	FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: GetNotificationPosts :many
+SELECT posts.id, posts.title, posts.url, posts.description, posts.published_at, posts.author,
+feeds.name AS feed_name
+FROM posts
+INNER JOIN feeds
+ON posts.feed_id = feeds.id
+WHERE posts.id = ANY(sqlc.arg(post_ids)::uuid[])
+ORDER BY posts.published_at NULLS LAST;
+
+-- name: MarkDeliveriesDelivered :exec
+UPDATE notification_deliveries
+SET status = 'delivered', attempts = attempts + 1, last_error = NULL, delivered_at = sqlc.arg(delivered_at)
+WHERE target_id = sqlc.arg(target_id)
+AND post_id = ANY(sqlc.arg(post_ids)::uuid[]);
+
+-- name: MarkDeliveriesFailed :exec
+-- deliveries that have used up their attempts stop being retried
+UPDATE notification_deliveries
+SET attempts = attempts + 1,
+last_error = sqlc.arg(last_error),
+next_attempt_at = sqlc.arg(next_attempt_at),
+status = CASE WHEN attempts + 1 >= sqlc.arg(max_attempts)::int THEN 'failed' ELSE 'pending' END
+WHERE target_id = sqlc.arg(target_id)
+AND post_id = ANY(sqlc.arg(post_ids)::uuid[]);
+
+-- name: GetDeliveryLog :many
+SELECT notification_targets.name AS target_name, posts.title, posts.url,
+notification_deliveries.status, notification_deliveries.attempts, notification_deliveries.last_error,
+notification_deliveries.created_at, notification_deliveries.delivered_at
+FROM notification_deliveries
+INNER JOIN notification_targets
+ON notification_deliveries.target_id = notification_targets.id
+INNER JOIN posts
+ON notification_deliveries.post_id = posts.id
+WHERE notification_targets.user_id = sqlc.arg(user_id)
+ORDER BY notification_deliveries.created_at DESC
+LIMIT sqlc.arg('limit');
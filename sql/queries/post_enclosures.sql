@@ -0,0 +1,34 @@
+-- name: CreatePostEnclosure :exec
+-- enclosures of edited posts are saved again, a checksum recorded by download
+-- is kept unless the feed now gives one
+INSERT INTO post_enclosures (id, post_id, url, mime_type, length, duration_seconds, checksum)
+VALUES (
+	$1,
+	$2,
+	$3,
+	$4,
+	$5,
+	$6,
+	$7
+)
+ON CONFLICT (post_id, url) DO UPDATE
+SET mime_type = excluded.mime_type,
+length = excluded.length,
+duration_seconds = excluded.duration_seconds,
+checksum = coalesce(excluded.checksum, post_enclosures.checksum);
+
+-- name: DeleteStalePostEnclosures :exec
+-- removes the enclosures an edited post no longer has
+DELETE FROM post_enclosures
+WHERE post_id = sqlc.arg(post_id)
+AND NOT (url = ANY(sqlc.arg(urls)::text[]));
+
+-- name: GetEnclosuresForPosts :many
+SELECT * FROM post_enclosures
+WHERE post_id = ANY(sqlc.arg(post_ids)::uuid[])
+ORDER BY post_id, url;
+
+-- name: SetEnclosureChecksum :exec
+UPDATE post_enclosures
+SET checksum = $2
+WHERE id = $1;
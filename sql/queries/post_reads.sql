@@ -0,0 +1,29 @@
+-- name: MarkPostRead :execrows
+INSERT INTO post_reads (user_id, post_id, read_at)
+VALUES (
+	$1,
+	$2,
+	$3
+)
+ON CONFLICT (user_id, post_id) DO NOTHING;
+
+-- name: MarkPostUnread :execrows
+DELETE FROM post_reads
+WHERE user_id = $1 AND post_id = $2;
+
+-- name: MarkFeedPostsRead :execrows
+INSERT INTO post_reads (user_id, post_id, read_at)
+SELECT $1, posts.id, $2
+FROM posts
+INNER JOIN feeds
+ON posts.feed_id = feeds.id
+WHERE feeds.url = $3
+ON CONFLICT (user_id, post_id) DO NOTHING;
+
+-- name: MarkFeedPostsUnread :execrows
+DELETE FROM post_reads
+USING posts, feeds
+WHERE post_reads.post_id = posts.id
+AND posts.feed_id = feeds.id
+AND post_reads.user_id = $1
+AND feeds.url = $2;
@@ -1,5 +1,6 @@
 -- name: CreatePost :one
-INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id)
+INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id, published_at_source,
+content, author, guid, guid_is_permalink, comments_url, item_key, content_hash, image_url)
 VALUES (
 	$1,
 	$2,
@@ -8,16 +9,255 @@ VALUES (
 	$5,
 	$6,
 	$7,
-	$8
+	$8,
+	$9,
+	$10,
+	$11,
+	$12,
+	$13,
+	$14,
+	$15,
+	$16,
+	$17
 )
 RETURNING *;
 
--- name: GetPostsForUser :many
-SELECT posts.title, posts.url, posts.description, posts.published_at, feeds.name as feed_name FROM posts
+-- name: AdoptLegacyPost :execrows
+-- posts saved before guids were stored were keyed on their link by the
+-- migration, the first fetch that sees the item's guid moves the post over to
+-- it so it isn't saved a second time. nothing happens if another post already
+-- has the guid as its key
+UPDATE posts
+SET item_key = sqlc.arg(guid), guid = sqlc.arg(guid), guid_is_permalink = sqlc.narg(guid_is_permalink)
+WHERE posts.feed_id = sqlc.arg(feed_id)
+AND posts.item_key = sqlc.arg(url)
+AND posts.guid IS NULL
+AND NOT EXISTS (
+	SELECT 1 FROM posts AS other
+	WHERE other.feed_id = sqlc.arg(feed_id)
+	AND other.item_key = sqlc.arg(guid)
+);
+
+-- name: UpdatePost :one
+-- records the stored version in post_revisions then overwrites it, nothing
+-- happens and no row is returned if the content and link are unchanged
+WITH revision AS (
+	INSERT INTO post_revisions (id, post_id, created_at, replaced_at, title, url, description, content, content_hash)
+	SELECT sqlc.arg(revision_id), posts.id, posts.updated_at, sqlc.arg(updated_at), posts.title, posts.url,
+	posts.description, posts.content, posts.content_hash
+	FROM posts
+	WHERE posts.feed_id = sqlc.arg(feed_id)
+	AND posts.item_key = sqlc.arg(item_key)
+	AND (posts.content_hash IS DISTINCT FROM sqlc.arg(content_hash) OR posts.url <> sqlc.arg(url))
+)
+UPDATE posts
+SET updated_at = sqlc.arg(updated_at),
+title = sqlc.narg(title),
+url = sqlc.arg(url),
+description = sqlc.narg(description),
+content = sqlc.narg(content),
+author = sqlc.narg(author),
+comments_url = sqlc.narg(comments_url),
+image_url = sqlc.narg(image_url),
+content_hash = sqlc.arg(content_hash)
+WHERE posts.feed_id = sqlc.arg(feed_id)
+AND posts.item_key = sqlc.arg(item_key)
+AND (posts.content_hash IS DISTINCT FROM sqlc.arg(content_hash) OR posts.url <> sqlc.arg(url))
+RETURNING posts.id;
+
+-- name: GetPostsForUserByPublished :many
+-- pages are walked with a keyset on (published_at, id), the cursor is the
+-- last row of the previous page. the sort column is a real column rather than
+-- a computed one so the keyset can use posts_feed_id_published_at_id_idx, and
+-- the descending cases fold away since postgres plans with the parameters
+SELECT posts.id, posts.title, posts.url, posts.description, posts.published_at, posts.created_at,
+feeds.name as feed_name, post_reads.read_at, posts.author, posts.image_url,
+EXISTS (
+	SELECT 1 FROM filter_matches
+	INNER JOIN filter_rules
+	ON filter_matches.rule_id = filter_rules.id
+	WHERE filter_matches.post_id = posts.id
+	AND filter_rules.user_id = feed_follows.user_id
+	AND filter_rules.action = 'highlight'
+) AS highlighted,
+ARRAY(
+	SELECT post_categories.category
+	FROM post_categories
+	WHERE post_categories.post_id = posts.id
+	ORDER BY post_categories.category
+)::text[] as categories
+FROM posts
+INNER JOIN feed_follows
+ON posts.feed_id = feed_follows.feed_id
+INNER JOIN feeds
+ON posts.feed_id = feeds.id
+LEFT JOIN post_reads
+ON posts.id = post_reads.post_id
+AND post_reads.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = sqlc.arg(user_id)
+AND (sqlc.arg(include_read)::bool OR post_reads.read_at IS NULL)
+AND (sqlc.arg(include_hidden)::bool OR NOT EXISTS (
+	SELECT 1 FROM filter_matches
+	INNER JOIN filter_rules
+	ON filter_matches.rule_id = filter_rules.id
+	WHERE filter_matches.post_id = posts.id
+	AND filter_rules.user_id = feed_follows.user_id
+	AND filter_rules.action = 'hide'
+))
+AND (sqlc.narg(feed_id)::uuid IS NULL OR posts.feed_id = sqlc.narg(feed_id))
+AND (sqlc.narg(tag)::text IS NULL OR EXISTS (
+	SELECT 1 FROM feed_follow_tags
+	WHERE feed_follow_tags.feed_follow_id = feed_follows.id
+	AND feed_follow_tags.tag = sqlc.narg(tag)
+))
+AND (sqlc.narg(author)::text IS NULL OR posts.author ILIKE '%' || sqlc.narg(author) || '%')
+AND (sqlc.narg(category)::text IS NULL OR EXISTS (
+	SELECT 1 FROM post_categories
+	WHERE post_categories.post_id = posts.id
+	AND lower(post_categories.category) = lower(sqlc.narg(category))
+))
+AND (NOT sqlc.arg(media_only)::bool OR EXISTS (
+	SELECT 1 FROM post_enclosures
+	WHERE post_enclosures.post_id = posts.id
+))
+AND (sqlc.narg(since)::timestamp IS NULL OR posts.published_at >= sqlc.narg(since))
+AND (sqlc.narg(until)::timestamp IS NULL OR posts.published_at < sqlc.narg(until))
+AND (sqlc.narg(cursor_key)::timestamp IS NULL OR CASE WHEN sqlc.arg(descending)::bool
+	THEN (posts.published_at, posts.id) < (sqlc.narg(cursor_key), sqlc.narg(cursor_id)::uuid)
+	ELSE (posts.published_at, posts.id) > (sqlc.narg(cursor_key), sqlc.narg(cursor_id)::uuid)
+END)
+ORDER BY
+CASE WHEN sqlc.arg(descending)::bool THEN posts.published_at END DESC,
+CASE WHEN sqlc.arg(descending)::bool THEN posts.id END DESC,
+posts.published_at ASC,
+posts.id ASC
+LIMIT sqlc.arg('limit');
+
+-- name: GetPostsForUserByFetched :many
+-- the same as GetPostsForUserByPublished but sorted on when the post was
+-- fetched, the two have to select the same columns
+SELECT posts.id, posts.title, posts.url, posts.description, posts.published_at, posts.created_at,
+feeds.name as feed_name, post_reads.read_at, posts.author, posts.image_url,
+EXISTS (
+	SELECT 1 FROM filter_matches
+	INNER JOIN filter_rules
+	ON filter_matches.rule_id = filter_rules.id
+	WHERE filter_matches.post_id = posts.id
+	AND filter_rules.user_id = feed_follows.user_id
+	AND filter_rules.action = 'highlight'
+) AS highlighted,
+ARRAY(
+	SELECT post_categories.category
+	FROM post_categories
+	WHERE post_categories.post_id = posts.id
+	ORDER BY post_categories.category
+)::text[] as categories
+FROM posts
 INNER JOIN feed_follows
 ON posts.feed_id = feed_follows.feed_id
 INNER JOIN feeds
 ON posts.feed_id = feeds.id
-WHERE feed_follows.user_id = $1
-ORDER BY posts.updated_at ASC
-LIMIT $2;
+LEFT JOIN post_reads
+ON posts.id = post_reads.post_id
+AND post_reads.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = sqlc.arg(user_id)
+AND (sqlc.arg(include_read)::bool OR post_reads.read_at IS NULL)
+AND (sqlc.arg(include_hidden)::bool OR NOT EXISTS (
+	SELECT 1 FROM filter_matches
+	INNER JOIN filter_rules
+	ON filter_matches.rule_id = filter_rules.id
+	WHERE filter_matches.post_id = posts.id
+	AND filter_rules.user_id = feed_follows.user_id
+	AND filter_rules.action = 'hide'
+))
+AND (sqlc.narg(feed_id)::uuid IS NULL OR posts.feed_id = sqlc.narg(feed_id))
+AND (sqlc.narg(tag)::text IS NULL OR EXISTS (
+	SELECT 1 FROM feed_follow_tags
+	WHERE feed_follow_tags.feed_follow_id = feed_follows.id
+	AND feed_follow_tags.tag = sqlc.narg(tag)
+))
+AND (sqlc.narg(author)::text IS NULL OR posts.author ILIKE '%' || sqlc.narg(author) || '%')
+AND (sqlc.narg(category)::text IS NULL OR EXISTS (
+	SELECT 1 FROM post_categories
+	WHERE post_categories.post_id = posts.id
+	AND lower(post_categories.category) = lower(sqlc.narg(category))
+))
+AND (NOT sqlc.arg(media_only)::bool OR EXISTS (
+	SELECT 1 FROM post_enclosures
+	WHERE post_enclosures.post_id = posts.id
+))
+AND (sqlc.narg(since)::timestamp IS NULL OR posts.created_at >= sqlc.narg(since))
+AND (sqlc.narg(until)::timestamp IS NULL OR posts.created_at < sqlc.narg(until))
+AND (sqlc.narg(cursor_key)::timestamp IS NULL OR CASE WHEN sqlc.arg(descending)::bool
+	THEN (posts.created_at, posts.id) < (sqlc.narg(cursor_key), sqlc.narg(cursor_id)::uuid)
+	ELSE (posts.created_at, posts.id) > (sqlc.narg(cursor_key), sqlc.narg(cursor_id)::uuid)
+END)
+ORDER BY
+CASE WHEN sqlc.arg(descending)::bool THEN posts.created_at END DESC,
+CASE WHEN sqlc.arg(descending)::bool THEN posts.id END DESC,
+posts.created_at ASC,
+posts.id ASC
+LIMIT sqlc.arg('limit');
+
+-- name: GetPostByID :one
+SELECT posts.*, feeds.name AS feed_name
+FROM posts
+INNER JOIN feeds
+ON posts.feed_id = feeds.id
+WHERE posts.id = $1;
+
+-- name: GetPostByUrl :one
+-- several feeds can carry the same link, the oldest post wins
+SELECT * FROM posts
+WHERE url = $1
+ORDER BY created_at
+LIMIT 1;
+
+-- name: SearchPosts :many
+SELECT posts.id, posts.title, posts.url, posts.published_at, feeds.name as feed_name, posts.author,
+ts_rank(posts.search, tsq)::real AS rank,
+ts_headline('english', coalesce(posts.description, posts.title, ''), tsq,
+	'StartSel=**, StopSel=**, MaxFragments=2, MaxWords=25, MinWords=10')::text AS snippet
+FROM posts
+INNER JOIN feeds
+ON posts.feed_id = feeds.id,
+websearch_to_tsquery('english', sqlc.arg(query)) tsq
+WHERE posts.search @@ tsq
+AND (sqlc.narg(feed_url)::text IS NULL OR feeds.url = sqlc.narg(feed_url))
+AND (sqlc.narg(since)::timestamp IS NULL OR posts.published_at >= sqlc.narg(since))
+AND (sqlc.narg(until)::timestamp IS NULL OR posts.published_at < sqlc.narg(until))
+AND (sqlc.narg(author)::text IS NULL OR posts.author ILIKE '%' || sqlc.narg(author) || '%')
+AND (sqlc.narg(category)::text IS NULL OR EXISTS (
+	SELECT 1 FROM post_categories
+	WHERE post_categories.post_id = posts.id
+	AND lower(post_categories.category) = lower(sqlc.narg(category))
+))
+AND (NOT sqlc.arg(followed_only)::bool OR EXISTS (
+	SELECT 1 FROM feed_follows
+	WHERE feed_follows.feed_id = posts.feed_id
+	AND feed_follows.user_id = sqlc.arg(user_id)
+))
+AND (sqlc.arg(include_hidden)::bool OR NOT EXISTS (
+	SELECT 1 FROM filter_matches
+	INNER JOIN filter_rules
+	ON filter_matches.rule_id = filter_rules.id
+	WHERE filter_matches.post_id = posts.id
+	AND filter_rules.user_id = sqlc.arg(user_id)
+	AND filter_rules.action = 'hide'
+))
+ORDER BY rank DESC, posts.published_at DESC NULLS LAST
+LIMIT sqlc.arg('limit');
+
+-- name: CreatePostCategory :exec
+INSERT INTO post_categories (post_id, category)
+VALUES (
+	$1,
+	$2
+)
+ON CONFLICT (post_id, category) DO NOTHING;
+
+-- name: DeleteStalePostCategories :exec
+-- removes the categories an edited post no longer has
+DELETE FROM post_categories
+WHERE post_id = sqlc.arg(post_id)
+AND NOT (category = ANY(sqlc.arg(categories)::text[]));
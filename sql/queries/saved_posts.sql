@@ -0,0 +1,19 @@
+-- name: SavePost :one
+INSERT INTO saved_posts (id, created_at, user_id, post_id, title, url, description, published_at, feed_name)
+SELECT sqlc.arg(id), sqlc.arg(created_at), sqlc.arg(user_id), posts.id, posts.title, posts.url, posts.description, posts.published_at, feeds.name
+FROM posts
+INNER JOIN feeds
+ON posts.feed_id = feeds.id
+WHERE posts.id = sqlc.arg(post_id)
+RETURNING *;
+
+-- name: GetSavedPostsForUser :many
+SELECT * FROM saved_posts
+WHERE user_id = $1
+ORDER BY created_at DESC;
+
+-- name: DeleteSavedPost :one
+DELETE FROM saved_posts
+WHERE user_id = $1
+AND (post_id = $2 OR url = $3)
+RETURNING *;
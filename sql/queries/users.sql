@@ -1,10 +1,11 @@
 -- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, name)
+INSERT INTO users (id, created_at, updated_at, name, api_key_hash)
 VALUES (
 	$1,
 	$2,
 	$3,
-	$4
+	$4,
+	$5
 )
 RETURNING *;
 
@@ -12,9 +13,19 @@ RETURNING *;
 SELECT * FROM users
 WHERE name = $1;
 
+-- name: GetUserByAPIKey :one
+SELECT * FROM users
+WHERE api_key_hash = $1;
+
 -- name: GetUsers :many
 SELECT * FROM users
 ORDER BY created_at;
 
+-- name: SetUserAPIKey :one
+UPDATE users
+SET updated_at = $2, api_key_hash = $3
+WHERE id = $1
+RETURNING *;
+
 -- name: ResetUsers :exec
 DELETE FROM users;
@@ -0,0 +1,25 @@
+-- +goose Up
+ALTER TABLE feeds
+ADD COLUMN last_error TEXT;
+
+ALTER TABLE feeds
+ADD COLUMN last_status INTEGER;
+
+ALTER TABLE feeds
+ADD COLUMN failure_count INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE feeds
+ADD COLUMN next_fetch_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE feeds
+DROP COLUMN last_error;
+
+ALTER TABLE feeds
+DROP COLUMN last_status;
+
+ALTER TABLE feeds
+DROP COLUMN failure_count;
+
+ALTER TABLE feeds
+DROP COLUMN next_fetch_at;
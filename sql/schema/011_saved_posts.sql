@@ -0,0 +1,20 @@
+-- +goose Up
+-- saved posts keep a copy of the post so they outlive the feed they came from,
+-- post_id is only kept as a link back while the post still exists
+CREATE TABLE saved_posts (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	user_id UUID NOT NULL,
+	post_id UUID,
+	title TEXT,
+	url TEXT NOT NULL,
+	description TEXT,
+	published_at TIMESTAMP,
+	feed_name TEXT NOT NULL,
+	FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+	FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE SET NULL,
+	UNIQUE (user_id, url)
+);
+
+-- +goose Down
+DROP TABLE saved_posts;
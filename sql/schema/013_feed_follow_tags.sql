@@ -0,0 +1,12 @@
+-- +goose Up
+CREATE TABLE feed_follow_tags (
+	feed_follow_id UUID NOT NULL,
+	tag TEXT NOT NULL,
+	PRIMARY KEY (feed_follow_id, tag),
+	FOREIGN KEY (feed_follow_id) REFERENCES feed_follows (id) ON DELETE CASCADE
+);
+
+CREATE INDEX feed_follow_tags_tag_idx ON feed_follow_tags (tag);
+
+-- +goose Down
+DROP TABLE feed_follow_tags;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE posts
+ADD COLUMN published_at_source TEXT;
+
+-- +goose Down
+ALTER TABLE posts
+DROP COLUMN published_at_source;
@@ -0,0 +1,42 @@
+-- +goose Up
+ALTER TABLE posts
+ADD COLUMN content TEXT;
+
+ALTER TABLE posts
+ADD COLUMN author TEXT;
+
+ALTER TABLE posts
+ADD COLUMN guid TEXT;
+
+ALTER TABLE posts
+ADD COLUMN guid_is_permalink BOOLEAN;
+
+ALTER TABLE posts
+ADD COLUMN comments_url TEXT;
+
+CREATE TABLE post_categories (
+	post_id UUID NOT NULL,
+	category TEXT NOT NULL,
+	PRIMARY KEY (post_id, category),
+	FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE
+);
+
+CREATE INDEX post_categories_category_idx ON post_categories (lower(category));
+
+-- +goose Down
+DROP TABLE post_categories;
+
+ALTER TABLE posts
+DROP COLUMN content;
+
+ALTER TABLE posts
+DROP COLUMN author;
+
+ALTER TABLE posts
+DROP COLUMN guid;
+
+ALTER TABLE posts
+DROP COLUMN guid_is_permalink;
+
+ALTER TABLE posts
+DROP COLUMN comments_url;
@@ -0,0 +1,73 @@
+-- +goose Up
+-- posts are deduplicated per feed on their guid, or their link when there's no
+-- guid, rather than on the link alone. content_hash covers the title,
+-- description and content so edits to an item can be spotted
+ALTER TABLE posts
+ADD COLUMN item_key TEXT;
+
+ALTER TABLE posts
+ADD COLUMN content_hash TEXT;
+
+UPDATE posts
+SET item_key = url,
+content_hash = encode(sha256(convert_to(
+	coalesce(title, '') || E'\n' || coalesce(description, '') || E'\n' || coalesce(content, ''),
+	'UTF8'
+)), 'hex');
+
+-- some feeds reuse guids, those posts stay keyed on their link
+UPDATE posts
+SET item_key = guid
+WHERE guid IS NOT NULL
+AND NOT EXISTS (
+	SELECT 1 FROM posts AS other
+	WHERE other.feed_id = posts.feed_id
+	AND other.id <> posts.id
+	AND (other.guid = posts.guid OR other.url = posts.guid)
+);
+
+ALTER TABLE posts
+ALTER COLUMN item_key SET NOT NULL;
+
+ALTER TABLE posts
+DROP CONSTRAINT posts_url_key;
+
+ALTER TABLE posts
+ADD CONSTRAINT posts_feed_id_item_key_key UNIQUE (feed_id, item_key);
+
+CREATE INDEX posts_url_idx ON posts (url);
+
+-- the version of a post that was replaced, created_at is when that version was
+-- stored and replaced_at is when it was overwritten
+CREATE TABLE post_revisions (
+	id UUID PRIMARY KEY,
+	post_id UUID NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	replaced_at TIMESTAMP NOT NULL,
+	title TEXT,
+	url TEXT NOT NULL,
+	description TEXT,
+	content TEXT,
+	content_hash TEXT,
+	FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE
+);
+
+CREATE INDEX post_revisions_post_id_idx ON post_revisions (post_id, replaced_at);
+
+-- +goose Down
+DROP TABLE post_revisions;
+
+DROP INDEX posts_url_idx;
+
+ALTER TABLE posts
+DROP CONSTRAINT posts_feed_id_item_key_key;
+
+-- fails if two feeds have since stored the same link
+ALTER TABLE posts
+ADD CONSTRAINT posts_url_key UNIQUE (url);
+
+ALTER TABLE posts
+DROP COLUMN content_hash;
+
+ALTER TABLE posts
+DROP COLUMN item_key;
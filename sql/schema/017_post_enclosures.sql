@@ -0,0 +1,23 @@
+-- +goose Up
+ALTER TABLE posts
+ADD COLUMN image_url TEXT;
+
+-- checksum is "algo:hex", either taken from the feed's media:hash or the sha256
+-- of the first completed download
+CREATE TABLE post_enclosures (
+	id UUID PRIMARY KEY,
+	post_id UUID NOT NULL,
+	url TEXT NOT NULL,
+	mime_type TEXT,
+	length BIGINT,
+	duration_seconds INTEGER,
+	checksum TEXT,
+	FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE,
+	UNIQUE (post_id, url)
+);
+
+-- +goose Down
+DROP TABLE post_enclosures;
+
+ALTER TABLE posts
+DROP COLUMN image_url;
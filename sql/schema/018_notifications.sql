@@ -0,0 +1,45 @@
+-- +goose Up
+-- a target is somewhere new posts get pushed to, either for a single feed or
+-- for every followed feed with a tag. url is the webhook url for webhook and
+-- slack targets and smtp://[user:password@]host:port for email ones
+CREATE TABLE notification_targets (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+	user_id UUID NOT NULL,
+	name TEXT NOT NULL,
+	kind TEXT NOT NULL CHECK (kind IN ('webhook', 'slack', 'email')),
+	url TEXT NOT NULL,
+	email_from TEXT,
+	email_to TEXT,
+	feed_id UUID,
+	tag TEXT,
+	FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+	FOREIGN KEY (feed_id) REFERENCES feeds (id) ON DELETE CASCADE,
+	UNIQUE (user_id, name),
+	CHECK ((feed_id IS NULL) <> (tag IS NULL))
+);
+
+-- one row per post per target doubles as the outbox and the delivery log,
+-- the primary key is what stops a post being sent to a target twice
+CREATE TABLE notification_deliveries (
+	target_id UUID NOT NULL,
+	post_id UUID NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'delivered', 'failed')),
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT,
+	next_attempt_at TIMESTAMP NOT NULL,
+	delivered_at TIMESTAMP,
+	PRIMARY KEY (target_id, post_id),
+	FOREIGN KEY (target_id) REFERENCES notification_targets (id) ON DELETE CASCADE,
+	FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE
+);
+
+CREATE INDEX notification_deliveries_due_idx ON notification_deliveries (next_attempt_at)
+WHERE status = 'pending';
+
+-- +goose Down
+DROP TABLE notification_deliveries;
+
+DROP TABLE notification_targets;
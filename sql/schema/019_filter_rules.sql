@@ -0,0 +1,36 @@
+-- +goose Up
+-- an exclude rule acts on posts that match it, an include rule acts on posts
+-- that don't. feed_id narrows a rule to one feed, otherwise it covers every
+-- feed the user follows
+CREATE TABLE filter_rules (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	user_id UUID NOT NULL,
+	mode TEXT NOT NULL CHECK (mode IN ('include', 'exclude')),
+	field TEXT NOT NULL CHECK (field IN ('any', 'title', 'description', 'author', 'category')),
+	match_type TEXT NOT NULL CHECK (match_type IN ('keyword', 'regex')),
+	pattern TEXT NOT NULL,
+	action TEXT NOT NULL CHECK (action IN ('hide', 'read', 'highlight')),
+	feed_id UUID,
+	FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+	FOREIGN KEY (feed_id) REFERENCES feeds (id) ON DELETE CASCADE
+);
+
+CREATE INDEX filter_rules_user_id_idx ON filter_rules (user_id);
+
+-- rules are evaluated once as posts are ingested, the result is kept here so
+-- removing a rule undoes its hiding and highlighting
+CREATE TABLE filter_matches (
+	rule_id UUID NOT NULL,
+	post_id UUID NOT NULL,
+	PRIMARY KEY (rule_id, post_id),
+	FOREIGN KEY (rule_id) REFERENCES filter_rules (id) ON DELETE CASCADE,
+	FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE
+);
+
+CREATE INDEX filter_matches_post_id_idx ON filter_matches (post_id);
+
+-- +goose Down
+DROP TABLE filter_matches;
+
+DROP TABLE filter_rules;
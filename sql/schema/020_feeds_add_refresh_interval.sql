@@ -0,0 +1,26 @@
+-- +goose Up
+-- refresh_interval_seconds and adaptive are set per feed with set-interval,
+-- publisher_interval_seconds is what the feed's ttl or sy:updatePeriod asks
+-- for and is kept so it still applies after a 304
+ALTER TABLE feeds
+ADD COLUMN refresh_interval_seconds INTEGER;
+
+ALTER TABLE feeds
+ADD COLUMN adaptive BOOLEAN NOT NULL DEFAULT false;
+
+ALTER TABLE feeds
+ADD COLUMN publisher_interval_seconds INTEGER;
+
+CREATE INDEX posts_feed_id_published_at_idx ON posts (feed_id, published_at DESC);
+
+-- +goose Down
+DROP INDEX posts_feed_id_published_at_idx;
+
+ALTER TABLE feeds
+DROP COLUMN publisher_interval_seconds;
+
+ALTER TABLE feeds
+DROP COLUMN adaptive;
+
+ALTER TABLE feeds
+DROP COLUMN refresh_interval_seconds;
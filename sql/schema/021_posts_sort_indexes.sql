@@ -0,0 +1,20 @@
+-- +goose Up
+-- posts are always given a published_at when they're fetched now, falling
+-- back to the fetch time, older rows get the same treatment so browse can sort
+-- on the column directly
+UPDATE posts
+SET published_at = created_at, published_at_source = 'fetched'
+WHERE published_at IS NULL;
+
+DROP INDEX posts_feed_id_published_at_idx;
+
+CREATE INDEX posts_feed_id_published_at_id_idx ON posts (feed_id, published_at, id);
+
+CREATE INDEX posts_feed_id_created_at_id_idx ON posts (feed_id, created_at, id);
+
+-- +goose Down
+DROP INDEX posts_feed_id_created_at_id_idx;
+
+DROP INDEX posts_feed_id_published_at_id_idx;
+
+CREATE INDEX posts_feed_id_published_at_idx ON posts (feed_id, published_at DESC);
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"net/url"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/LegendLoreLori/radgregator/internal/database"
+	"github.com/gdamore/tcell/v2"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/rivo/tview"
+)
+
+var (
+	blockTagRegex = regexp.MustCompile(`(?i)<\s*(br|/p|/div|/h[1-6]|/tr|/blockquote|/pre|hr)\b[^>]*>`)
+	listTagRegex  = regexp.MustCompile(`(?i)<\s*li\b[^>]*>`)
+	dropTagRegex  = regexp.MustCompile(`(?is)<\s*(script|style)\b.*?</\s*(script|style)\s*>`)
+	anyTagRegex   = regexp.MustCompile(`(?s)<[^>]*>`)
+	blankRegex    = regexp.MustCompile(`\n(?:[ \t]*\n)+`)
+)
+
+// htmlToText flattens a post's html into something readable in a terminal,
+// block elements become line breaks and every other tag is dropped
+func htmlToText(s string) string {
+	s = dropTagRegex.ReplaceAllString(s, "")
+	s = blockTagRegex.ReplaceAllString(s, "\n")
+	s = listTagRegex.ReplaceAllString(s, "\n • ")
+	s = anyTagRegex.ReplaceAllString(s, "")
+	s = html.UnescapeString(s)
+	s = strings.ReplaceAll(s, "\u00a0", " ")
+	s = blankRegex.ReplaceAllString(s, "\n\n")
+	return strings.TrimSpace(s)
+}
+
+// openBrowser hands an http or https url to the system's opener, links come
+// from feeds so anything else, like a file: url or a local path, is refused
+// rather than opened or run
+func openBrowser(link string) error {
+	u, err := url.Parse(link)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("refusing to open %q, only http and https links are opened", link)
+	}
+	target := u.String()
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("open", target).Start()
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", target).Start()
+	default:
+		return exec.Command("xdg-open", target).Start()
+	}
+}
+
+// reader is the state behind the tui, feeds and posts mirror what's in the
+// two lists so an index into a list is an index into its slice
+type reader struct {
+	s           *state
+	user        database.User
+	limit       int
+	includeRead bool
+
+	feeds []database.GetFeedFollowsForUserRow
+	posts []database.GetPostsForUserByPublishedRow
+	feed  uuid.NullUUID
+
+	app      *tview.Application
+	feedList *tview.List
+	postList *tview.List
+	preview  *tview.TextView
+	status   *tview.TextView
+}
+
+const readerHelp = "tab switch pane · enter open · r read/unread · s save · o open in browser · a show read · u refresh · q quit"
+
+func handlerTUI(s *state, cmd command, user database.User) error {
+	fs := flag.NewFlagSet("tui", flag.ContinueOnError)
+	limit := fs.Int("limit", 100, "maximum number of posts to load per feed")
+	includeRead := fs.Bool("include-read", false, "start with read posts shown")
+	if _, err := cmd.parseFlags(fs); err != nil {
+		return err
+	}
+
+	r := &reader{
+		s:           s,
+		user:        user,
+		limit:       *limit,
+		includeRead: *includeRead,
+		app:         tview.NewApplication(),
+		feedList:    tview.NewList().ShowSecondaryText(false).SetHighlightFullLine(true),
+		postList:    tview.NewList().SetHighlightFullLine(true),
+		preview:     tview.NewTextView().SetWordWrap(true),
+		status:      tview.NewTextView().SetText(readerHelp),
+	}
+	r.feedList.SetBorder(true).SetTitle(" feeds ")
+	r.postList.SetBorder(true).SetTitle(" posts ")
+	r.preview.SetBorder(true).SetTitle(" preview ")
+
+	r.feedList.SetSelectedFunc(func(index int, _, _ string, _ rune) {
+		r.selectFeed(index)
+		r.app.SetFocus(r.postList)
+	})
+	r.postList.SetChangedFunc(func(index int, _, _ string, _ rune) {
+		r.showPost(index, false)
+	})
+	r.postList.SetSelectedFunc(func(index int, _, _ string, _ rune) {
+		r.showPost(index, true)
+		r.app.SetFocus(r.preview)
+	})
+
+	panes := tview.NewFlex().
+		AddItem(r.feedList, 0, 1, true).
+		AddItem(r.postList, 0, 2, false).
+		AddItem(r.preview, 0, 3, false)
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(panes, 0, 1, true).
+		AddItem(r.status, 1, 0, false)
+	r.app.SetRoot(layout, true).SetInputCapture(r.handleKey)
+
+	if err := r.loadFeeds(); err != nil {
+		return err
+	}
+	r.selectFeed(0)
+	return r.app.Run()
+}
+
+func (r *reader) handleKey(event *tcell.EventKey) *tcell.EventKey {
+	focus := r.app.GetFocus()
+	switch event.Key() {
+	case tcell.KeyTab:
+		r.cycleFocus(1)
+		return nil
+	case tcell.KeyBacktab:
+		r.cycleFocus(-1)
+		return nil
+	case tcell.KeyEscape:
+		if focus == r.preview {
+			r.app.SetFocus(r.postList)
+		} else {
+			r.app.SetFocus(r.feedList)
+		}
+		return nil
+	case tcell.KeyRune:
+	default:
+		return event
+	}
+
+	switch event.Rune() {
+	case 'q':
+		r.app.Stop()
+	case 'j':
+		return tcell.NewEventKey(tcell.KeyDown, 0, tcell.ModNone)
+	case 'k':
+		return tcell.NewEventKey(tcell.KeyUp, 0, tcell.ModNone)
+	case 'h':
+		r.cycleFocus(-1)
+	case 'l':
+		r.cycleFocus(1)
+	case 'r':
+		r.toggleRead()
+	case 's':
+		r.savePost()
+	case 'o':
+		r.openPost()
+	case 'a':
+		r.includeRead = !r.includeRead
+		r.reloadPosts()
+	case 'u':
+		if err := r.loadFeeds(); err != nil {
+			r.setStatus("unable to load feeds: %v", err)
+			break
+		}
+		r.reloadPosts()
+	default:
+		return event
+	}
+	return nil
+}
+
+func (r *reader) cycleFocus(step int) {
+	panes := []tview.Primitive{r.feedList, r.postList, r.preview}
+	current := 0
+	for i, pane := range panes {
+		if pane == r.app.GetFocus() {
+			current = i
+		}
+	}
+	r.app.SetFocus(panes[(current+step+len(panes))%len(panes)])
+}
+
+func (r *reader) setStatus(format string, args ...any) {
+	r.status.SetText(fmt.Sprintf(format, args...))
+}
+
+// loadFeeds fills the feed pane, the first entry is every followed feed at
+// once
+func (r *reader) loadFeeds() error {
+	feeds, err := r.s.db.GetFeedFollowsForUser(context.Background(), database.GetFeedFollowsForUserParams{
+		Name: r.user.Name,
+	})
+	if err != nil {
+		return err
+	}
+	r.feeds = feeds
+
+	current := r.feedList.GetCurrentItem()
+	r.feedList.Clear()
+	r.feedList.AddItem("all feeds", "", 0, nil)
+	for _, feed := range feeds {
+		r.feedList.AddItem(tview.Escape(feed.FeedName), "", 0, nil)
+	}
+	r.feedList.SetCurrentItem(current)
+	return nil
+}
+
+func (r *reader) selectFeed(index int) {
+	r.feed = uuid.NullUUID{}
+	title := " posts "
+	if index > 0 && index <= len(r.feeds) {
+		r.feed = uuid.NullUUID{
+			UUID:  r.feeds[index-1].FeedID,
+			Valid: true,
+		}
+		title = fmt.Sprintf(" %s ", tview.Escape(r.feeds[index-1].FeedName))
+	}
+	r.postList.SetTitle(title)
+	r.reloadPosts()
+}
+
+func (r *reader) reloadPosts() {
+	posts, err := r.s.db.GetPostsForUserByPublished(context.Background(), database.GetPostsForUserByPublishedParams{
+		UserID:      r.user.ID,
+		IncludeRead: r.includeRead,
+		FeedID:      r.feed,
+		Descending:  true,
+		Limit:       int32(r.limit),
+	})
+	if err != nil {
+		r.setStatus("unable to load posts: %v", err)
+		return
+	}
+	r.posts = posts
+
+	r.preview.Clear()
+	r.postList.Clear()
+	for i := range posts {
+		text, secondary := r.postText(i)
+		r.postList.AddItem(text, secondary, 0, nil)
+	}
+	if len(posts) == 0 {
+		r.preview.SetText("no posts")
+	} else {
+		r.showPost(r.postList.GetCurrentItem(), false)
+	}
+	r.setStatus("%d posts · %s", len(posts), readerHelp)
+}
+
+func (r *reader) postText(index int) (string, string) {
+	post := r.posts[index]
+	marker := "● "
+	if post.ReadAt.Valid {
+		marker = "  "
+	}
+	if post.Highlighted {
+		marker += "★ "
+	}
+	title := post.Title.String
+	if title == "" {
+		title = post.Url
+	}
+	secondary := post.FeedName
+	if post.PublishedAt.Valid {
+		secondary += " · " + post.PublishedAt.Time.Format(time.DateOnly)
+	}
+	return marker + tview.Escape(title), "  " + tview.Escape(secondary)
+}
+
+func (r *reader) currentPost() (database.GetPostsForUserByPublishedRow, bool) {
+	index := r.postList.GetCurrentItem()
+	if index < 0 || index >= len(r.posts) {
+		return database.GetPostsForUserByPublishedRow{}, false
+	}
+	return r.posts[index], true
+}
+
+// showPost renders the post in the preview pane, the full content is used
+// when the feed provided it. opening a post is what marks it as read, just
+// moving past it in the list doesn't
+func (r *reader) showPost(index int, markRead bool) {
+	if index < 0 || index >= len(r.posts) {
+		return
+	}
+	post, err := r.s.db.GetPostByID(context.Background(), r.posts[index].ID)
+	if err != nil {
+		r.setStatus("unable to load post: %v", err)
+		return
+	}
+
+	body := post.Content.String
+	if body == "" {
+		body = post.Description.String
+	}
+	var header strings.Builder
+	fmt.Fprintf(&header, "%s\n%s\n", post.Title.String, post.Url)
+	if post.Author.Valid {
+		fmt.Fprintf(&header, "by %s\n", post.Author.String)
+	}
+	if post.PublishedAt.Valid {
+		fmt.Fprintf(&header, "%s\n", post.PublishedAt.Time.Format(time.RFC1123))
+	}
+	r.preview.SetText(header.String() + "\n" + htmlToText(body))
+	r.preview.ScrollToBeginning()
+
+	if markRead && !r.posts[index].ReadAt.Valid {
+		r.setRead(index, true)
+	}
+}
+
+func (r *reader) setRead(index int, read bool) {
+	post := r.posts[index]
+	var err error
+	if read {
+		_, err = r.s.db.MarkPostRead(context.Background(), database.MarkPostReadParams{
+			UserID: r.user.ID,
+			PostID: post.ID,
+			ReadAt: time.Now(),
+		})
+		r.posts[index].ReadAt = sql.NullTime{Time: time.Now(), Valid: true}
+	} else {
+		_, err = r.s.db.MarkPostUnread(context.Background(), database.MarkPostUnreadParams{
+			UserID: r.user.ID,
+			PostID: post.ID,
+		})
+		r.posts[index].ReadAt = sql.NullTime{}
+	}
+	if err != nil {
+		r.setStatus("unable to update post: %v", err)
+		return
+	}
+	text, secondary := r.postText(index)
+	r.postList.SetItemText(index, text, secondary)
+}
+
+func (r *reader) toggleRead() {
+	post, ok := r.currentPost()
+	if !ok {
+		return
+	}
+	r.setRead(r.postList.GetCurrentItem(), !post.ReadAt.Valid)
+	if post.ReadAt.Valid {
+		r.setStatus("marked %q unread", post.Title.String)
+	} else {
+		r.setStatus("marked %q read", post.Title.String)
+	}
+}
+
+func (r *reader) savePost() {
+	post, ok := r.currentPost()
+	if !ok {
+		return
+	}
+	_, err := r.s.db.SavePost(context.Background(), database.SavePostParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UserID:    r.user.ID,
+		PostID:    post.ID,
+	})
+	var sqlErr *pq.Error
+	if errors.As(err, &sqlErr) && sqlErr.Code == "23505" { // duplicate key entry
+		r.setStatus("%q is already saved", post.Title.String)
+	} else if err != nil {
+		r.setStatus("unable to save post: %v", err)
+	} else {
+		r.setStatus("saved %q", post.Title.String)
+	}
+}
+
+func (r *reader) openPost() {
+	post, ok := r.currentPost()
+	if !ok {
+		return
+	}
+	if err := openBrowser(post.Url); err != nil {
+		r.setStatus("unable to open post: %v", err)
+		return
+	}
+	r.setStatus("opened %s", post.Url)
+}